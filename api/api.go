@@ -13,15 +13,17 @@ import (
 	"strings"
 	//	"time"
 
-	//	"github.com/gin-contrib/cors"
 	//	"github.com/gin-contrib/static"
 	//	"github.com/gin-gonic/autotls"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	// "golang.org/x/crypto/acme/autocert"
 	// "gopkg.in/yaml.v3"
 	"zonetree/cache"
+	"zonetree/dig"
 	"zonetree/html"
 	"zonetree/logger"
+	"zonetree/metrics"
 )
 
 const (
@@ -32,18 +34,51 @@ const (
 	ContentTypeText   = "text/plain; charset=utf-8"
 )
 
-var cfg cache.Config
+// Largest zone file accepted as request body by /cache/import
+const maxUploadSize = 64 << 20
+
+// Servers with the most timeouts reported by /metrics
+const timeoutServers = 20
+
+var cfg *cache.Config
 var Log = logger.PrintDebugLog()
-var Zones = cache.NewZoneCache()
+var Zones = cache.NewIndexedZones(cache.NewZoneCache())
 var Cache = cache.NewServerCache()
 
-func Run() {
+func Run(serverConf string) {
+
+	sc, err := LoadServerConfig(serverConf)
+	if err != nil {
+		log.Fatalf("Unable to load server config %s: %v", serverConf, err)
+	}
 
 	cfg = cache.Init(&Log, Zones, Cache)
 
+	if sc.CacheFile != "" {
+		if err := cfg.LoadFile(sc.CacheFile); err != nil {
+			Log.Error("Unable to load cache. Starting empty", "file", sc.CacheFile, "Error", err)
+		}
+	}
+
+	metrics.CacheSize("zones", Zones.Count)
+	metrics.CacheSize("servers", Cache.Count)
+	metrics.ServerTimeouts(timeoutServers, func() []metrics.ServerTimeout { return cache.ServerTimeouts(Cache) })
+
 	router := gin.Default()
 
-	router.GET("/conf/show", func(c *gin.Context) {
+	if mw := sc.corsMiddleware(); mw != nil {
+		router.Use(mw)
+	}
+
+	// Everything needs a valid token. Reading is open to all roles,
+	// anything that changes state or sends DNS queries needs operator.
+	router.Use(sc.Auth.authenticate())
+	reader := router.Group("/", requireRole(RoleRead))
+	operator := router.Group("/", requireRole(RoleOperator))
+
+	reader.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	reader.GET("/conf/show", func(c *gin.Context) {
 
 		outstr := cfg.RunningConf()
 
@@ -51,71 +86,40 @@ func Run() {
 
 	})
 
-	router.GET("/conf/load/*file", func(c *gin.Context) {
+	operator.POST("/conf/load/*file", func(c *gin.Context) {
 
 		file := strings.TrimLeft(c.Param("file"), "/")
 
-		var outstr string
+		audit(c, "Load profile", file)
 
 		err := cfg.Load(file)
 		if err != nil {
-			outstr = err.Error()
-		} else {
-			outstr = "loaded conf file" + file
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(cache.ProfileErrorText(err)))
+			return
 		}
 
-		c.Data(http.StatusOK, ContentTypeHTML, []byte(outstr))
+		c.Data(http.StatusOK, ContentTypeHTML, []byte("loaded conf file "+file))
 
 	})
 
-	router.GET("/cache/tree/*zone", func(c *gin.Context) {
+	profileRoutes(reader, operator)
+	undelegatedRoutes(operator)
+	digRoutes(operator)
+	traceRoutes(operator)
+	depsRoutes(operator)
+	indexRoutes(reader)
+	whatifRoutes(reader)
+	asnRoutes(operator)
+	probeRoutes(operator)
+
+	reader.GET("/cache/tree/*zone", func(c *gin.Context) {
 		// trim any leading slash (applies when no 'name' is provided)
 		zone := strings.TrimLeft(c.Param("zone"), "/")
 		if zone != "" {
 			zone = cache.ToFQDN(strings.ToLower(zone))
 		}
 
-		// default outstr if nothing returned from cache
-		//outstr := "Zone not in cache:[" + zone + "]\n"
-		list := cache.DigPath(zone)
-		tree := cfg.ZoneCutPath(list)
-		tree = append([]string{"."}, tree...)
-
-		fmt.Printf("\n%v\n", tree)
-
-		// Recursively (o_O) go through the list
-		var tr func(l []string) html.Node
-
-		tr = func(l []string) html.Node {
-
-			var HN html.Node
-
-			// Get Current zone
-			var qns bool
-			if z, ok := Zones.Get(l[0]); ok {
-
-				HN.Name = z.Name
-
-				qns = false
-				for _, ns := range z.NSIP {
-					//fmt.Printf("qns: %v : %v\n", qns, ns.ZoneStatus)
-					if qns == false && (ns.ZoneStatus == 200 || ns.ZoneStatus == 0) && len(l) > 1 {
-						n := tr(l[1:])
-						HN.Children = append(HN.Children, n)
-						qns = true
-
-					} else {
-						n := html.Node{Name: ns.Name + " (" + ns.IP + ")", Parent: &HN}
-						HN.Children = append(HN.Children, n)
-					}
-				}
-
-			}
-
-			return HN
-		}
-
-		var nodetree html.Node = tr(tree)
+		var nodetree html.Node = zoneTree(zone, nil)
 
 		outstr, err := json.MarshalIndent(nodetree, "", "  ")
 		if err != nil {
@@ -135,7 +139,7 @@ func Run() {
 
 	})
 
-	router.GET("/cache/list/*zone", func(c *gin.Context) {
+	reader.GET("/cache/list/*zone", func(c *gin.Context) {
 		// trim any leading slash (applies when no 'name' is provided)
 		zone := strings.TrimLeft(c.Param("zone"), "/")
 		if zone != "" {
@@ -145,7 +149,12 @@ func Run() {
 		// default outstr if nothing returned from cache
 		outstr := "Zone not in cache:[" + zone + "]\n"
 
+		// ?format=zone gives RFC 1035 master file text instead of JSON
 		if z, ok := Zones.Get(zone); ok {
+			if c.Query("format") == "zone" {
+				c.Data(http.StatusOK, ContentTypeText, []byte(z.ToZoneFile()))
+				return
+			}
 			outstr, _ = z.ToPrettyJson()
 		}
 
@@ -153,7 +162,7 @@ func Run() {
 
 	})
 
-	router.GET("/cache/clear/*zone", func(c *gin.Context) {
+	operator.DELETE("/cache/clear/*zone", func(c *gin.Context) {
 		// trim any leading slash (applies when no 'name' is provided)
 		zone := strings.TrimLeft(c.Param("zone"), "/")
 		if zone != "" {
@@ -167,9 +176,10 @@ func Run() {
 			if z.Name != "." {
 				// Dont delete the ROOT
 				Zones.Remove(zone)
+				audit(c, "Clear zone", zone)
 				outstr = "Zone [" + z.Name + "] removed from cache"
 			} else {
-				outstr = "ERROR: ROOT cannot be deleted. Restart to load new data from root-hints."
+				outstr = "ERROR: ROOT cannot be deleted. It is re-primed when its TTL expires."
 			}
 		}
 
@@ -177,10 +187,12 @@ func Run() {
 
 	})
 
-	router.GET("/cache/reset", func(c *gin.Context) {
+	operator.POST("/cache/reset", func(c *gin.Context) {
 
 		var outstr string
 
+		audit(c, "Reset cache", "")
+
 		for z := range cfg.Zones.IterBuffered() {
 			if zone, ok := Zones.Get(z.Value.Name); ok {
 				// Dont delete the ROOT
@@ -195,7 +207,33 @@ func Run() {
 
 	})
 
-	router.GET("/cache/dump", func(c *gin.Context) {
+	// Seed the cache with the delegations in a zone file.
+	// Either ?file=<name> for a file in hints/, or the zone file as body,
+	// of at most maxUploadSize. Larger files go in hints/.
+	operator.POST("/cache/import/*origin", func(c *gin.Context) {
+		origin := cache.ToFQDN(strings.ToLower(strings.TrimLeft(c.Param("origin"), "/")))
+		file := c.Query("file")
+
+		audit(c, "Import zone file", origin, "file", file)
+
+		var count int
+		var err error
+		if file != "" {
+			count, err = cfg.ImportHintZoneFile(file, origin)
+		} else {
+			body := http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+			count, err = cfg.ImportZoneFile(body, origin, "upload")
+		}
+		if err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+
+		c.Data(http.StatusOK, ContentTypeText, []byte(fmt.Sprintf("Imported %d zones from %s\n", count, origin)))
+
+	})
+
+	reader.GET("/cache/dump", func(c *gin.Context) {
 
 		var outstr string
 
@@ -210,21 +248,55 @@ func Run() {
 
 	})
 
-	router.GET("/test/*zone", func(c *gin.Context) {
+	// Build the tree for a zone.
+	// Optional query parameters:
+	//   profile=<name>	- run with this profile instead of the running one
+	//   isolate=true	- run with an empty cache, and return the zones built
+	//   qtype=<type>	- also ask all servers of the final zone for this RRset
+	// An inline profile (YAML or JSON Options) can be sent as request body.
+	operator.POST("/test/*zone", func(c *gin.Context) {
 		// trim any leading slash (applies when no 'name' is provided)
 		zone := strings.ToLower(strings.TrimLeft(c.Param("zone"), "/"))
 
-		cache.BuildZoneCache(zone, &cfg)
+		bcfg, err := requestConfig(c)
+		if err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(cache.ProfileErrorText(err)))
+			return
+		}
+
+		qtype := strings.ToUpper(c.Query("qtype"))
+		if qtype != "" && dig.TypeToInt(qtype) == 0 {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte("Unknown qtype "+qtype+"\n"))
+			return
+		}
+
+		audit(c, "Build zone", zone, "profile", c.Query("profile"), "isolate", c.Query("isolate"), "qtype", qtype)
 
 		outstr := "Testing Zone:[" + zone + "]\n"
+
+		// ResolveAnswer builds the path of each name in the chain itself
+		if qtype == "" {
+			cache.BuildZoneCache(zone, bcfg)
+		} else {
+			jstr, _ := json.MarshalIndent(bcfg.ResolveAnswer(zone, qtype), "", "  ")
+			outstr += string(jstr) + "\n"
+		}
+
+		// Isolated caches are thrown away after the request,
+		// so return what was built.
+		if bcfg.Zones != cfg.Zones {
+			for _, name := range cache.DigPath(zone) {
+				if z, ok := bcfg.Zones.Get(name); ok {
+					jstr, _ := z.ToPrettyJson()
+					outstr += jstr + "\n"
+				}
+			}
+		}
+
 		c.Data(http.StatusOK, ContentTypeHTML, []byte(outstr))
 
 	})
 
-	server := &http.Server{
-		Addr:    ":7777",
-		Handler: router,
-	}
-	log.Fatal(server.ListenAndServe())
+	serve(sc, router)
 
 }
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"zonetree/cache"
+)
+
+// asnRoutes
+//
+// Reload the prefix to ASN table (hints/pfx2as.txt), e.g. after
+// downloading a fresh routeviews dump. Zones get the new data when
+// they are rebuilt.
+func asnRoutes(operator *gin.RouterGroup) {
+
+	operator.POST("/asn/reload", func(c *gin.Context) {
+		audit(c, "Reload ASN table", cache.ASNFile)
+
+		n, err := cache.LoadASNTable(cache.ASNFile, Log)
+		if err != nil {
+			c.Data(http.StatusInternalServerError, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+
+		c.Data(http.StatusOK, ContentTypeText, []byte("Loaded "+strconv.Itoa(n)+" prefixes\n"))
+	})
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles, in increasing order of privilege.
+// An operator can do everything a reader can.
+const (
+	RoleRead     = "read"
+	RoleOperator = "operator"
+)
+
+var roleLevel = map[string]int{
+	RoleRead:     1,
+	RoleOperator: 2,
+}
+
+// Keys used for storing the authenticated caller in the gin.Context
+const (
+	ctxUser = "user"
+	ctxRole = "role"
+)
+
+// Audit log. All mutating operations and triggered builds end up here.
+var Audit = Log.With("log", "audit")
+
+// Shortest token accepted. Guessable tokens are as good as none.
+const minTokenLen = 16
+
+// AuthConfig
+//
+// API tokens allowed to use the server. At least one token is needed,
+// unless authentication is explicitly turned off with Disabled, in
+// which case every caller is treated as operator.
+type AuthConfig struct {
+	Disabled bool       `yaml:"Disabled"`
+	Tokens   []APIToken `yaml:"Tokens"`
+}
+
+// APIToken
+//
+// Name is used in the audit log to identify the caller.
+type APIToken struct {
+	Name  string `yaml:"Name"`
+	Token string `yaml:"Token"`
+	Role  string `yaml:"Role"`
+}
+
+// validate
+//
+// Check that there are tokens, and that all of them are usable.
+func (ac AuthConfig) validate() error {
+	if ac.Disabled {
+		return nil
+	}
+	if len(ac.Tokens) < 1 {
+		return errors.New("no API tokens configured. Set Auth.Disabled to run without authentication")
+	}
+	for _, t := range ac.Tokens {
+		if t.Name == "" || t.Token == "" {
+			return errors.New("API token needs both Name and Token")
+		}
+		if len(t.Token) < minTokenLen {
+			return errors.New("API token " + t.Name + " is shorter than " + strconv.Itoa(minTokenLen) + " characters")
+		}
+		if _, ok := roleLevel[t.Role]; !ok {
+			return errors.New("API token " + t.Name + " has unknown role " + t.Role)
+		}
+	}
+	return nil
+}
+
+// authenticate
+//
+// Middleware that looks up the bearer token of the request and stores
+// the caller name and role in the context. Requests with a missing or
+// unknown token are rejected.
+func (ac AuthConfig) authenticate() gin.HandlerFunc {
+
+	if ac.Disabled {
+		Log.Warn("Auth.Disabled is set. Authentication is DISABLED")
+		return func(c *gin.Context) {
+			c.Set(ctxUser, "anonymous")
+			c.Set(ctxRole, RoleOperator)
+		}
+	}
+
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok {
+			for _, t := range ac.Tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+					c.Set(ctxUser, t.Name)
+					c.Set(ctxRole, t.Role)
+					return
+				}
+			}
+		}
+		Audit.Warn("Authentication failed", "remote", c.ClientIP(), "method", c.Request.Method, "path", c.Request.URL.Path)
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+// requireRole
+//
+// Middleware that rejects callers with less privilege than role.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if roleLevel[c.GetString(ctxRole)] < roleLevel[role] {
+			Audit.Warn("Access denied", "user", c.GetString(ctxUser), "role", c.GetString(ctxRole), "method", c.Request.Method, "path", c.Request.URL.Path)
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	}
+}
+
+// audit
+//
+// Log who did what to which target. Extra key/value pairs can be added.
+func audit(c *gin.Context, action, target string, args ...any) {
+	args = append([]any{"user", c.GetString(ctxUser), "remote", c.ClientIP(), "target", target}, args...)
+	Audit.Info(action, args...)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		readToken     = "reader-token-0123456789"
+		operatorToken = "operator-token-0123456789"
+	)
+	tokens := AuthConfig{Tokens: []APIToken{
+		{Name: "alice", Token: readToken, Role: RoleRead},
+		{Name: "bob", Token: operatorToken, Role: RoleOperator},
+	}}
+
+	// Same layout as Run: authenticate first, then a role per group
+	router := func(ac AuthConfig) *gin.Engine {
+		r := gin.New()
+		r.Use(ac.authenticate())
+		r.Group("/", requireRole(RoleRead)).GET("/read", func(c *gin.Context) { c.String(http.StatusOK, c.GetString(ctxUser)) })
+		r.Group("/", requireRole(RoleOperator)).POST("/operate", func(c *gin.Context) { c.String(http.StatusOK, c.GetString(ctxUser)) })
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		ac     AuthConfig
+		method string
+		path   string
+		header string
+		status int
+		user   string
+	}{
+		{"missing token", tokens, "GET", "/read", "", http.StatusUnauthorized, ""},
+		{"bad token", tokens, "GET", "/read", "Bearer not-a-known-token-at-all", http.StatusUnauthorized, ""},
+		{"token without Bearer", tokens, "GET", "/read", readToken, http.StatusUnauthorized, ""},
+		{"prefix of a token", tokens, "GET", "/read", "Bearer " + readToken[:10], http.StatusUnauthorized, ""},
+		{"reader reads", tokens, "GET", "/read", "Bearer " + readToken, http.StatusOK, "alice"},
+		{"reader on operator route", tokens, "POST", "/operate", "Bearer " + readToken, http.StatusForbidden, ""},
+		{"operator reads", tokens, "GET", "/read", "Bearer " + operatorToken, http.StatusOK, "bob"},
+		{"operator operates", tokens, "POST", "/operate", "Bearer " + operatorToken, http.StatusOK, "bob"},
+		{"disabled", AuthConfig{Disabled: true}, "POST", "/operate", "", http.StatusOK, "anonymous"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router(tt.ac).ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if w.Body.String() != tt.user {
+				t.Errorf("user = %q, want %q", w.Body.String(), tt.user)
+			}
+		})
+	}
+}
+
+func TestAuthValidate(t *testing.T) {
+	token := strings.Repeat("x", minTokenLen)
+
+	tests := []struct {
+		name string
+		ac   AuthConfig
+		err  bool
+	}{
+		{"ok", AuthConfig{Tokens: []APIToken{{Name: "a", Token: token, Role: RoleRead}}}, false},
+		{"disabled without tokens", AuthConfig{Disabled: true}, false},
+		{"no tokens", AuthConfig{}, true},
+		{"too short", AuthConfig{Tokens: []APIToken{{Name: "a", Token: token[1:], Role: RoleRead}}}, true},
+		{"no name", AuthConfig{Tokens: []APIToken{{Token: token, Role: RoleRead}}}, true},
+		{"no token", AuthConfig{Tokens: []APIToken{{Name: "a", Role: RoleRead}}}, true},
+		{"unknown role", AuthConfig{Tokens: []APIToken{{Name: "a", Token: token, Role: "admin"}}}, true},
+		{"no role", AuthConfig{Tokens: []APIToken{{Name: "a", Token: token}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.ac.validate(); (err != nil) != tt.err {
+				t.Errorf("validate() = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigTokens(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		yaml string // Empty for no file at all
+		err  bool
+	}{
+		{"no file", "", true},
+		{"no tokens", "Listen: [\"127.0.0.1:8080\"]\n", true},
+		{"short token", "Auth:\n  Tokens:\n    - {Name: a, Token: short, Role: read}\n", true},
+		{"token", "Auth:\n  Tokens:\n    - {Name: a, Token: " + strings.Repeat("x", minTokenLen) + ", Role: read}\n", false},
+		{"disabled", "Auth:\n  Disabled: true\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".yaml")
+			if tt.yaml != "" {
+				if err := os.WriteFile(file, []byte(tt.yaml), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := LoadServerConfig(file); (err != nil) != tt.err {
+				t.Errorf("LoadServerConfig() = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
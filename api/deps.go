@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// depsRoutes
+//
+// Transitive dependency graph of a name. Builds the cache for every
+// zone involved, so it is an operator route.
+// ?format=dot	- Graphviz DOT instead of JSON
+func depsRoutes(operator *gin.RouterGroup) {
+
+	operator.POST("/deps/*name", func(c *gin.Context) {
+		name := strings.TrimLeft(c.Param("name"), "/")
+		if name == "" {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte("Missing name\n"))
+			return
+		}
+
+		audit(c, "Dependency graph", name)
+
+		g := cfg.Snapshot().Dependencies(name)
+
+		if c.Query("format") == "dot" {
+			c.Data(http.StatusOK, ContentTypeText, []byte(g.Dot()))
+			return
+		}
+
+		c.JSON(http.StatusOK, g)
+	})
+}
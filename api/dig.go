@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"zonetree/cache"
+	"zonetree/dig"
+)
+
+// Upper limits for client supplied query timing. maxDigWait caps the
+// worst case of all of them together, per server. The servers of a Zone
+// are queried in parallel, so that is also the worst case of a request.
+const (
+	maxDigTimeout = 30 * time.Second
+	maxDigRetries = 10
+	maxDigBackoff = 5 * time.Second
+	maxDigWait    = 2 * time.Minute
+	maxDigServers = 32 // Of a Zone, the fastest are used
+)
+
+// DigRequest
+//
+// A dig.Query, plus where to send it and how to format the output.
+// Nameserver is an IP address or host name, empty for the system resolver.
+// If Zone is set, the query is sent to every authoritative server of
+// that zone in the cache, all at once, and Nameserver is ignored.
+// Format is "json" (default) or "text" (dig style).
+type DigRequest struct {
+	dig.Query
+	Zone   string `json:"Zone"`
+	Format string `json:"Format"`
+}
+
+// validate
+//
+// Check the parts of the query that come from the client.
+func (r *DigRequest) validate() error {
+	var errs []error
+
+	if r.Qname == "" {
+		errs = append(errs, errors.New("Qname: missing"))
+	}
+	if dig.TypeToInt(r.Qtype) == 0 {
+		errs = append(errs, errors.New("Qtype: unknown type "+r.Qtype))
+	}
+	if dig.ClassToInt(r.Qclass) == 0 {
+		errs = append(errs, errors.New("Qclass: unknown class "+r.Qclass))
+	}
+	if r.EdnsOpt != "" {
+		if _, err := dig.ParseEdnsOpt(r.EdnsOpt); err != nil {
+			errs = append(errs, errors.New("EdnsOpt: "+err.Error()))
+		}
+	}
+	if _, err := hex.DecodeString(r.Cookie); err != nil {
+		errs = append(errs, errors.New("Cookie: not hex"))
+	}
+	switch strings.ToLower(r.Transport) {
+	case "udp", "tcp":
+	default:
+		errs = append(errs, errors.New("Transport: must be udp or tcp"))
+	}
+	switch r.IpVersion {
+	case "4", "6":
+	default:
+		errs = append(errs, errors.New("IpVersion: must be 4 or 6"))
+	}
+	if p, err := strconv.Atoi(r.Port); err != nil || p < 1 || p > 65535 {
+		errs = append(errs, errors.New("Port: not a port number"))
+	}
+	if r.Timeout < 0 || r.Timeout > maxDigTimeout {
+		errs = append(errs, errors.New("Timeout: must be between 0 and "+maxDigTimeout.String()))
+	}
+	if r.Retries < 0 || r.Retries > maxDigRetries {
+		errs = append(errs, errors.New("Retries: must be between 0 and "+strconv.Itoa(maxDigRetries)))
+	}
+	if r.Backoff < 0 || r.Backoff > maxDigBackoff {
+		errs = append(errs, errors.New("Backoff: must be between 0 and "+maxDigBackoff.String()))
+	}
+	if len(errs) == 0 && r.wait() > maxDigWait {
+		errs = append(errs, errors.New("Timeout, Retries and Backoff: may add up to "+r.wait().String()+", more than "+maxDigWait.String()))
+	}
+	if r.Nameserver != "" && r.Zone == "" && net.ParseIP(r.Nameserver) == nil {
+		if _, ok := dns.IsDomainName(r.Nameserver); !ok {
+			errs = append(errs, errors.New("Nameserver: not an IP address or host name"))
+		}
+	}
+	switch r.Format {
+	case "", "json", "text":
+	default:
+		errs = append(errs, errors.New("Format: must be json or text"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// wait
+//
+// Get the longest time one server can take: a timeout for each try, and
+// the backoff before each retry, doubled each time (see dig.Exchange).
+func (r *DigRequest) wait() time.Duration {
+	timeout, backoff := r.Timeout, r.Backoff
+	if timeout <= 0 {
+		timeout = dig.DefaultTimeout
+	}
+	if backoff <= 0 {
+		backoff = dig.DefaultBackoff
+	}
+	return time.Duration(r.Retries+1)*timeout + backoff*(1<<r.Retries-1)
+}
+
+// servers
+//
+// Get the list of servers to send the query to. For a Zone, at most
+// maxDigServers, fastest first.
+func (r *DigRequest) servers() ([]string, error) {
+	if r.Zone == "" {
+		return []string{r.Nameserver}, nil
+	}
+
+	zone, ok := cfg.Zones.Get(cache.ToFQDN(strings.ToLower(r.Zone)))
+	if !ok {
+		return nil, errors.New("Zone not in cache: " + r.Zone)
+	}
+
+	var nslist map[string]string
+	if r.IpVersion == "6" {
+		nslist = zone.GetNSIP6()
+	} else {
+		nslist = zone.GetNSIP4()
+	}
+	if len(nslist) < 1 {
+		return nil, errors.New("No IPv" + r.IpVersion + " nameservers in cache for zone " + r.Zone)
+	}
+
+	servers := cfg.OrderByRTT(nslist)
+	return servers[:min(len(servers), maxDigServers)], nil
+}
+
+// digRoutes
+//
+// Send arbitrary queries, with all the options of dig.Query.
+// Takes a DigRequest as JSON body. Fields not set keep the values
+// from dig.NewQuery()
+func digRoutes(operator *gin.RouterGroup) {
+
+	operator.POST("/dig", func(c *gin.Context) {
+
+		req := DigRequest{Query: dig.NewQuery(), Format: "json"}
+		req.Qtype = "A"
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+		if err := req.validate(); err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+
+		servers, err := req.servers()
+		if err != nil {
+			c.Data(http.StatusNotFound, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+
+		audit(c, "Dig", req.Qname, "qtype", req.Qtype, "servers", strings.Join(servers, " "))
+
+		// In parallel, one slow server should not hold up the rest
+		result := make([]dig.DigOut, len(servers))
+		var wg sync.WaitGroup
+		for i, server := range servers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q := req.Query
+				q.Nameserver = server
+				out, _ := dig.Exchange(q)
+				if !q.ShowQuery {
+					out.Query = nil
+				}
+				result[i] = out
+			}()
+		}
+		wg.Wait()
+
+		if req.Format == "text" {
+			var outstr string
+			for _, out := range result {
+				outstr += out.String() + "\n"
+			}
+			c.Data(http.StatusOK, ContentTypeText, []byte(outstr))
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	})
+}
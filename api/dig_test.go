@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"zonetree/cache"
+	"zonetree/dig"
+	"zonetree/logger"
+)
+
+func TestDigZoneServers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Servers that never answer, all on the same port
+	var nsip []cache.NSIP
+	var zns []cache.ZoneNS
+	port := "0"
+	for i := range maxDigServers + 2 {
+		ip := fmt.Sprintf("127.0.0.%d", i+1)
+		pc, err := net.ListenPacket("udp", net.JoinHostPort(ip, port))
+		if err != nil {
+			t.Skipf("no test server on %s: %v", ip, err)
+		}
+		defer pc.Close()
+		port = strconv.Itoa(pc.LocalAddr().(*net.UDPAddr).Port)
+		nsip = append(nsip, cache.NSIP{Name: fmt.Sprintf("ns%d.example.", i+1), IP: ip})
+		zns = append(zns, cache.ZoneNS{Self: int8(i), NS: []int8{int8(i)}})
+	}
+
+	cfg = &cache.Config{Log: logger.DummyLogger{}, Zones: cache.NewZoneCache(), Cache: cache.NewServerCache()}
+	cfg.Zones.Set("example.", cache.Zone{Name: "example.", Status: 200, NSIP: nsip, ZoneNS: zns})
+
+	router := gin.New()
+	digRoutes(router.Group("/"))
+
+	req := DigRequest{Query: dig.NewQuery(), Zone: "example"}
+	req.Qname, req.Qtype, req.Port = "example.", "SOA", port
+	req.Timeout, req.Retries = 500*time.Millisecond, 0
+	body, _ := json.Marshal(req)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/dig", bytes.NewReader(body)))
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var result []dig.DigOut
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != maxDigServers {
+		t.Errorf("%d servers queried, want %d", len(result), maxDigServers)
+	}
+	// One timeout, not one per server
+	if elapsed > 3*req.Timeout {
+		t.Errorf("request took %s, want about %s", elapsed, req.Timeout)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// indexRoutes
+//
+// Reverse lookups in the Zone cache. Which zones use a nameserver,
+// which use an IP, and what two zones have in common.
+func indexRoutes(reader *gin.RouterGroup) {
+
+	reader.GET("/index/ns/*name", func(c *gin.Context) {
+		name := strings.TrimLeft(c.Param("name"), "/")
+		if name == "" {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte("Missing name\n"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"NS": name, "Zones": Zones.ZonesByNS(name)})
+	})
+
+	reader.GET("/index/ip/:ip", func(c *gin.Context) {
+		addr, err := netip.ParseAddr(c.Param("ip"))
+		if err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"IP": addr.String(), "NS": Zones.ZonesByIP(addr.String())})
+	})
+
+	// ?zone=a&zone=b
+	reader.GET("/index/shared", func(c *gin.Context) {
+		zones := c.QueryArray("zone")
+		if len(zones) != 2 {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte("Need exactly two zones (?zone=a&zone=b)\n"))
+			return
+		}
+		c.JSON(http.StatusOK, Zones.Shared(zones[0], zones[1]))
+	})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zonetree/cache"
+)
+
+// probeRoutes
+//
+// Probe the servers of a cached zone on demand, whether or not the
+// matching Query* option is set, and store the result with the zone.
+// /identity	- NSID, hostname.bind, id.server and version.bind
+// /edns	- EDNS compliance tests
+// /udpsize	- Response sizes and truncation at different UDP buffer sizes
+// /cookies	- DNS Cookie support
+func probeRoutes(operator *gin.RouterGroup) {
+
+	probe := func(path, action string, run func(z *cache.Zone, cfg *cache.Config) any) {
+		operator.POST(path+"/*name", func(c *gin.Context) {
+			name := cache.ToFQDN(strings.ToLower(strings.TrimLeft(c.Param("name"), "/")))
+
+			zone, ok := Zones.Get(name)
+			if !ok || len(zone.NSIP) < 1 {
+				c.Data(http.StatusNotFound, ContentTypeText, []byte("Zone not in cache: "+name+"\n"))
+				return
+			}
+
+			audit(c, action, name)
+
+			// Don't write to the NSIP list shared with the cached copy
+			zone.NSIP = slices.Clone(zone.NSIP)
+			result := run(&zone, cfg.Snapshot())
+			Zones.Set(name, zone)
+
+			c.JSON(http.StatusOK, result)
+		})
+	}
+
+	probe("/identity", "Probe identity", func(z *cache.Zone, cfg *cache.Config) any {
+		z.ProbeIdentity(cfg)
+		return z.Instances
+	})
+	probe("/edns", "Probe EDNS", func(z *cache.Zone, cfg *cache.Config) any {
+		z.ProbeEDNS(cfg)
+		return z.EDNS
+	})
+	probe("/udpsize", "Probe UDP size", func(z *cache.Zone, cfg *cache.Config) any {
+		z.ProbeUDPSize(cfg)
+		return z.UDPSize
+	})
+	probe("/cookies", "Probe cookies", func(z *cache.Zone, cfg *cache.Config) any {
+		z.ProbeCookies(cfg)
+		return z.Cookies
+	})
+}
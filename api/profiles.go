@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zonetree/cache"
+)
+
+// Max size of an uploaded profile
+const maxProfileSize = 64 << 10
+
+// profileRoutes
+//
+// List, show, validate and save profiles.
+// Switching the running profile is done with /conf/load
+func profileRoutes(reader, operator *gin.RouterGroup) {
+
+	reader.GET("/profiles", func(c *gin.Context) {
+		list, err := cache.ListProfiles()
+		if err != nil {
+			c.Data(http.StatusInternalServerError, ContentTypeText, []byte(err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	reader.GET("/profiles/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		if err := cache.ValidProfileName(name); err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()))
+			return
+		}
+		data, err := os.ReadFile(filepath.Join(cache.ProfileDir, name))
+		if err != nil {
+			c.Data(http.StatusNotFound, ContentTypeText, []byte("No such profile: "+name+"\n"))
+			return
+		}
+		c.Data(http.StatusOK, ContentTypeText, data)
+	})
+
+	// Validate a profile without saving or applying it
+	reader.POST("/profiles/validate", func(c *gin.Context) {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxProfileSize))
+		if err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()))
+			return
+		}
+		if _, err := cache.ParseProfile(data); err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(cache.ProfileErrorText(err)))
+			return
+		}
+		c.Data(http.StatusOK, ContentTypeText, []byte("Profile OK\n"))
+	})
+
+	operator.POST("/profiles/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxProfileSize))
+		if err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()))
+			return
+		}
+
+		audit(c, "Save profile", name)
+
+		if err := cache.SaveProfile(name, data); err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(cache.ProfileErrorText(err)))
+			return
+		}
+		c.Data(http.StatusOK, ContentTypeText, []byte("Saved profile "+name+"\n"))
+	})
+
+	// Build a name with several profiles, each in an isolated cache,
+	// and report the differences. ?profile=<name> can be repeated, and
+	// the name "running" means the currently running options.
+	operator.POST("/compare/*name", func(c *gin.Context) {
+		name := strings.ToLower(strings.TrimLeft(c.Param("name"), "/"))
+
+		profiles := make(map[string]cache.Options)
+		for _, p := range c.QueryArray("profile") {
+			if p == "running" {
+				profiles[p] = cfg.Snapshot().Opt
+				continue
+			}
+			opt, err := cache.ReadProfile(p)
+			if err != nil {
+				c.Data(http.StatusBadRequest, ContentTypeText, []byte(p+": "+cache.ProfileErrorText(err)))
+				return
+			}
+			profiles[p] = opt
+		}
+		if len(profiles) < 2 {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte("Need at least two profiles to compare\n"))
+			return
+		}
+
+		audit(c, "Compare profiles", name, "profiles", c.QueryArray("profile"))
+
+		c.JSON(http.StatusOK, cfg.Compare(name, profiles))
+	})
+}
+
+// requestConfig
+//
+// Get the Config to use for a single request. Defaults to a snapshot of
+// the running config. A profile can be selected with ?profile=<name> or
+// sent inline as request body, and ?isolate=true gives the request its
+// own empty caches.
+func requestConfig(c *gin.Context) (*cache.Config, error) {
+
+	rcfg := cfg.Snapshot()
+
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxProfileSize))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.Query("profile") != "" && len(data) > 0:
+		return nil, errors.New("use either ?profile or an inline profile, not both")
+	case c.Query("profile") != "":
+		opt, err := cache.ReadProfile(c.Query("profile"))
+		if err != nil {
+			return nil, err
+		}
+		rcfg = cfg.WithOptions(opt)
+	case len(data) > 0:
+		opt, err := cache.ParseProfile(data)
+		if err != nil {
+			return nil, err
+		}
+		rcfg = cfg.WithOptions(opt)
+	}
+
+	if c.Query("isolate") == "true" {
+		rcfg = rcfg.Isolated()
+	}
+
+	return rcfg, nil
+}
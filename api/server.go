@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// ServerConfig
+//
+// Settings for the HTTP server, loaded from a YAML file.
+//
+// Listen		- Addresses to listen on. One http.Server is started per address.
+// TLS			- Certificate and key. If both are set, all listeners use TLS.
+// CORS			- Allowed origins. Empty list means no CORS headers are sent.
+// ReadTimeout		- Max time for reading a full request.
+// WriteTimeout		- Max time for writing the response. Needs to cover a full zone build.
+// ShutdownTimeout	- Max time to wait for in-flight requests (builds) on SIGTERM.
+// CacheFile		- If set, the caches are loaded from here at start and saved on exit.
+// Auth			- API tokens and their roles. See AuthConfig.
+type ServerConfig struct {
+	Listen          []string      `yaml:"Listen"`
+	TLS             TLSConfig     `yaml:"TLS"`
+	CORS            CORSConfig    `yaml:"CORS"`
+	ReadTimeout     time.Duration `yaml:"ReadTimeout"`
+	WriteTimeout    time.Duration `yaml:"WriteTimeout"`
+	ShutdownTimeout time.Duration `yaml:"ShutdownTimeout"`
+	CacheFile       string        `yaml:"CacheFile"`
+	Auth            AuthConfig    `yaml:"Auth"`
+}
+
+type TLSConfig struct {
+	CertFile string `yaml:"CertFile"`
+	KeyFile  string `yaml:"KeyFile"`
+}
+
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"AllowOrigins"`
+}
+
+// DefaultServerConfig
+//
+// Settings used if no server config file can be found.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Listen:          []string{":7777"},
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    5 * time.Minute,
+		ShutdownTimeout: 1 * time.Minute,
+	}
+}
+
+// LoadServerConfig
+//
+// Read the server config from file, on top of the defaults.
+// A missing file is not an error, but as the defaults have no API
+// tokens, the server won't start without one (see AuthConfig).
+func LoadServerConfig(file string) (ServerConfig, error) {
+	sc := DefaultServerConfig()
+
+	cf, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		// Still no way in without tokens
+		return sc, sc.Auth.validate()
+	}
+	if err != nil {
+		return sc, err
+	}
+
+	if err := yaml.Unmarshal(cf, &sc); err != nil {
+		return sc, err
+	}
+	if len(sc.Listen) < 1 {
+		return sc, errors.New("no Listen address in server config")
+	}
+	if (sc.TLS.CertFile == "") != (sc.TLS.KeyFile == "") {
+		return sc, errors.New("TLS needs both CertFile and KeyFile")
+	}
+	if err := sc.Auth.validate(); err != nil {
+		return sc, err
+	}
+
+	return sc, nil
+}
+
+// corsMiddleware
+//
+// Build the CORS handler from the config. Nil if CORS is not configured.
+func (sc ServerConfig) corsMiddleware() gin.HandlerFunc {
+	if len(sc.CORS.AllowOrigins) < 1 {
+		return nil
+	}
+	cc := cors.DefaultConfig()
+	cc.AllowOrigins = sc.CORS.AllowOrigins
+	// Browsers need to be allowed to send the bearer token
+	cc.AllowHeaders = append(cc.AllowHeaders, "Authorization")
+	return cors.New(cc)
+}
+
+// serve
+//
+// Start one http.Server per listen address and block until SIGINT/SIGTERM
+// or a listener fails. On shutdown, in-flight requests (and thereby running
+// builds) are given ShutdownTimeout to finish before the caches are flushed.
+func serve(sc ServerConfig, handler http.Handler) {
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, len(sc.Listen))
+	var servers []*http.Server
+
+	for _, addr := range sc.Listen {
+		server := &http.Server{
+			Addr:         addr,
+			Handler:      handler,
+			ReadTimeout:  sc.ReadTimeout,
+			WriteTimeout: sc.WriteTimeout,
+		}
+		servers = append(servers, server)
+
+		go func() {
+			var err error
+			Log.Info("Starting server", "address", addr, "tls", sc.TLS.CertFile != "")
+			if sc.TLS.CertFile != "" {
+				err = server.ListenAndServeTLS(sc.TLS.CertFile, sc.TLS.KeyFile)
+			} else {
+				err = server.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				failed <- err
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		Log.Info("Shutting down. Waiting for in-flight requests", "timeout", sc.ShutdownTimeout)
+	case err := <-failed:
+		Log.Error("Server failed. Shutting down", "Error", err)
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), sc.ShutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(sctx); err != nil {
+			Log.Error("Server did not shut down cleanly", "address", server.Addr, "Error", err)
+		}
+	}
+
+	if sc.CacheFile != "" {
+		if err := cfg.SaveFile(sc.CacheFile); err != nil {
+			Log.Error("Unable to save cache", "file", sc.CacheFile, "Error", err)
+		} else {
+			Log.Info("Saved cache", "file", sc.CacheFile)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zonetree/dig"
+)
+
+// traceRoutes
+//
+// dig +trace style walk from the ROOT, using the servers in the cache.
+// ?qtype=	- Query type (default A)
+// ?all=true	- Query every server at each zone cut, not just the fastest
+// ?format=text	- dig style transcript instead of JSON
+func traceRoutes(operator *gin.RouterGroup) {
+
+	operator.POST("/trace/*name", func(c *gin.Context) {
+		name := strings.TrimLeft(c.Param("name"), "/")
+		if name == "" {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte("Missing name\n"))
+			return
+		}
+
+		qtype := strings.ToUpper(c.DefaultQuery("qtype", "A"))
+		if dig.TypeToInt(qtype) == 0 {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte("Unknown qtype "+qtype+"\n"))
+			return
+		}
+		all := c.Query("all") == "true"
+
+		audit(c, "Trace", name, "qtype", qtype, "all", all)
+
+		tr := cfg.Snapshot().Trace(name, qtype, all)
+
+		if c.Query("format") == "text" {
+			c.Data(http.StatusOK, ContentTypeText, []byte(tr.String()))
+			return
+		}
+
+		c.JSON(http.StatusOK, tr)
+	})
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"slices"
+
+	"zonetree/cache"
+	"zonetree/html"
+)
+
+// zoneTree
+//
+// Build the tree of zone cuts from the ROOT down to zone, with the
+// servers of each zone. colors, if set, maps zone names and server
+// labels (name (IP)) to the color of their node, see cache.Impact.
+func zoneTree(zone string, colors map[string]string) html.Node {
+
+	// default outstr if nothing returned from cache
+	//outstr := "Zone not in cache:[" + zone + "]\n"
+	list := cache.DigPath(zone)
+	tree := cfg.ZoneCutPath(list)
+	tree = append([]string{"."}, tree...)
+
+	Log.Debug("Zone tree", "zone", zone, "path", tree)
+
+	// Recursively (o_O) go through the list
+	var tr func(l []string, name string) html.Node
+
+	// If name is (below) an alias, link to the tree of the target.
+	// Aliases already seen are not followed again, to stop loops.
+	seen := map[string]bool{zone: true}
+	link := func(name string) (html.Node, bool) {
+		for _, node := range slices.Backward(cache.DigPath(name)) {
+			a, ok := Zones.Get(node)
+			if !ok || a.Status != 301 {
+				continue
+			}
+			n := html.Node{Name: a.Name + " " + a.AliasRR + " " + a.Alias, Alias: a.Alias}
+			if !seen[a.Alias] {
+				seen[a.Alias] = true
+				target := append([]string{"."}, cfg.ZoneCutPath(cache.DigPath(a.Alias))...)
+				n.Children = append(n.Children, tr(target, a.Alias))
+			}
+			return n, true
+		}
+		return html.Node{}, false
+	}
+
+	tr = func(l []string, name string) html.Node {
+
+		var HN html.Node
+
+		// Get Current zone
+		var qns bool
+		if z, ok := Zones.Get(l[0]); ok {
+
+			HN.Name = z.Name
+			HN.Color = colors[z.Name]
+
+			if len(l) == 1 {
+				if n, ok := link(name); ok {
+					HN.Children = append(HN.Children, n)
+				}
+			}
+
+			qns = false
+			for _, ns := range z.NSIP {
+				//fmt.Printf("qns: %v : %v\n", qns, ns.ZoneStatus)
+				if qns == false && (ns.ZoneStatus == 200 || ns.ZoneStatus == 0) && len(l) > 1 {
+					n := tr(l[1:], name)
+					HN.Children = append(HN.Children, n)
+					qns = true
+
+				} else {
+					label := ns.Name + " (" + ns.IP + ")"
+					n := html.Node{Name: label, Parent: &HN, Color: colors[label]}
+					HN.Children = append(HN.Children, n)
+				}
+			}
+
+		}
+
+		return HN
+	}
+
+	return tr(tree, zone)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zonetree/cache"
+)
+
+// undelegatedRoutes
+//
+// Test a zone against operator supplied NS (and optional glue and DS)
+// before it is delegated. Takes a cache.Undelegated as JSON body.
+func undelegatedRoutes(operator *gin.RouterGroup) {
+
+	operator.POST("/undelegated", func(c *gin.Context) {
+		var u cache.Undelegated
+		if err := c.ShouldBindJSON(&u); err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+
+		var ns []string
+		for _, n := range u.NS {
+			ns = append(ns, n.Name)
+		}
+		audit(c, "Undelegated test", u.Zone, "NS", strings.Join(ns, " "))
+
+		zone, err := cfg.Snapshot().TestUndelegated(u)
+		if err != nil && zone.Name == "" {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+
+		c.JSON(http.StatusOK, zone)
+	})
+}
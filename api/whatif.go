@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zonetree/cache"
+	"zonetree/html"
+)
+
+// WhatIfResponse
+//
+// Impact of a simulated failure, and optionally the tree of one zone
+// colored by it.
+type WhatIfResponse struct {
+	cache.Impact
+	Tree *html.Node `json:"Tree,omitempty"`
+}
+
+// whatifRoutes
+//
+// Simulate failures against the cache. Takes a cache.Failure as JSON
+// body. No queries are sent, so readers may use it.
+// ?tree=<zone>	- also return the tree of zone, colored by impact
+func whatifRoutes(reader *gin.RouterGroup) {
+
+	reader.POST("/whatif", func(c *gin.Context) {
+		var f cache.Failure
+		if err := c.ShouldBindJSON(&f); err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+
+		im, err := cfg.WhatIf(f)
+		if err != nil {
+			c.Data(http.StatusBadRequest, ContentTypeText, []byte(err.Error()+"\n"))
+			return
+		}
+
+		resp := WhatIfResponse{Impact: im}
+		if zone := c.Query("tree"); zone != "" {
+			tree := zoneTree(cache.ToFQDN(strings.ToLower(zone)), im.Colors)
+			resp.Tree = &tree
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+}
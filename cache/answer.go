@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"zonetree/dig"
+)
+
+// Max number of CNAME/DNAME links to follow before giving up
+const maxAliasChain = 8
+
+// ServerAnswer
+//
+// What one authoritative server answered for a name/type.
+type ServerAnswer struct {
+	Server  string   `json:"Server"`
+	IP      string   `json:"IP"`
+	Rcode   string   `json:"Rcode"`
+	AA      bool     `json:"AA"`
+	Records []string `json:"Records"` // Answer section, sorted, in master file format
+	Error   string   `json:"Error,omitempty"`
+}
+
+// AnswerStep
+//
+// One link in the chain, i.e. one name asked at all servers of its zone.
+// Target is set if the name turned out to be an alias (CNAME or DNAME).
+type AnswerStep struct {
+	Name        string         `json:"Name"`
+	Zone        string         `json:"Zone"`
+	Answers     []ServerAnswer `json:"Answers"`
+	Consistent  bool           `json:"Consistent"` // All responding servers gave the same answer
+	Differences []string       `json:"Differences"`
+	Alias       string         `json:"Alias,omitempty"` // CNAME or DNAME
+	Target      string         `json:"Target,omitempty"`
+}
+
+// Answer
+//
+// Result of resolving a name/type at the authoritative servers,
+// following aliases across zones.
+type Answer struct {
+	Name    string       `json:"Name"`
+	Qtype   string       `json:"Qtype"`
+	Chain   []AnswerStep `json:"Chain"`
+	Records []string     `json:"Records"` // Final RRset, from the first server with an answer
+	Error   string       `json:"Error,omitempty"`
+}
+
+// ResolveAnswer
+//
+// Build the path to name, then ask every authoritative server of the
+// closest zone cut for name/qtype. If the answer is a CNAME (or a DNAME
+// above name), the target is resolved the same way, in whatever zone it
+// lives in, until the RRset is found, or maxAliasChain links have been
+// followed.
+func (c *Config) ResolveAnswer(name, qtype string) Answer {
+
+	qtype = strings.ToUpper(qtype)
+	ans := Answer{Name: ToFQDN(strings.ToLower(name)), Qtype: qtype}
+
+	seen := make(map[string]bool)
+	name = ans.Name
+	for len(ans.Chain) < maxAliasChain {
+		if seen[name] {
+			ans.Error = "Alias loop at " + name
+			return ans
+		}
+		seen[name] = true
+
+		BuildZoneCache(name, c)
+
+		step := c.answerStep(name, qtype)
+		ans.Chain = append(ans.Chain, step)
+
+		if step.Target == "" {
+			// Final answer from the first server that gave one
+			for _, a := range step.Answers {
+				if a.Error == "" {
+					ans.Records = a.Records
+					break
+				}
+			}
+			return ans
+		}
+		name = step.Target
+	}
+
+	ans.Error = fmt.Sprintf("Alias chain longer than %d", maxAliasChain)
+	return ans
+}
+
+// answerStep
+//
+// Ask all servers of the zone holding name for name/qtype.
+func (c *Config) answerStep(name, qtype string) AnswerStep {
+
+	step := AnswerStep{Name: name}
+
+	// The closest enclosing zone cut holds the data. Except for DS,
+	// that lives in the parent.
+	cuts := append([]string{"."}, c.ZoneCutPath(dig.Path(name))...)
+	if qtype == "DS" && len(cuts) > 1 && cuts[len(cuts)-1] == name {
+		cuts = cuts[:len(cuts)-1]
+	}
+	step.Zone = cuts[len(cuts)-1]
+
+	zone, ok := c.Zones.Get(step.Zone)
+	if !ok {
+		step.Differences = append(step.Differences, "Zone not in cache: "+step.Zone)
+		return step
+	}
+
+	q := c.NewQuery()
+	q.Qname = name
+	q.Qtype = qtype
+
+	var groups []rrGroup
+	for _, ip := range c.OrderByRTT(c.nameservers(&zone)) {
+		q.Nameserver = ip
+		server := zone.nsNameByIP(ip)
+		msg, err := c.Query(q, server)
+
+		sa := ServerAnswer{Server: server, IP: ip, Rcode: msg.Rcode, AA: msg.AA}
+		if err != nil {
+			sa.Error = err.Error()
+			step.Answers = append(step.Answers, sa)
+			continue
+		}
+		for _, rr := range msg.Answer {
+			sa.Records = append(sa.Records, rrLine(strings.ToLower(rr.Name), nil, rr.Rtype, rr.GetRdata()))
+		}
+		slices.Sort(sa.Records)
+		step.Answers = append(step.Answers, sa)
+
+		// Group on rcode and answer, to spot disagreements
+		groups = addGroup(groups, append([]string{"rcode " + sa.Rcode}, sa.Records...), serverLabel(server, ip))
+
+		if !sa.AA {
+			step.Differences = append(step.Differences, "Not authoritative: "+serverLabel(server, ip))
+		}
+		if step.Target == "" && qtype != "CNAME" && qtype != "DNAME" {
+			step.Alias, step.Target = aliasTarget(name, qtype, msg.Answer)
+		}
+	}
+
+	step.Consistent = len(groups) < 2
+	if !step.Consistent {
+		for _, g := range groups {
+			step.Differences = append(step.Differences, fmt.Sprintf("%s: [%s]",
+				strings.Join(g.servers, ", "), strings.Join(g.records, "; ")))
+		}
+	}
+
+	return step
+}
+
+// aliasTarget
+//
+// Find the name to continue with if name is a CNAME, or below a DNAME.
+// An answer that holds the RRset asked for as well is not an alias, as
+// the server already followed the chain within its own zone.
+func aliasTarget(name, qtype string, answer []dig.DigRR) (string, string) {
+	if slices.ContainsFunc(answer, func(rr dig.DigRR) bool { return rr.Rtype == qtype }) {
+		return "", ""
+	}
+	rtype, target, _ := findAlias(name, answer)
+	return rtype, target
+}
+
+// findAlias
+//
+// Look for a CNAME owned by name, or a DNAME owned by one of its
+// ancestors, in an Answer section. The DNAME wins over the CNAME
+// synthesized from it. Returns the type, the target name
+// (synthesized for DNAME) and the TTL. Empty target if there is none.
+func findAlias(name string, answer []dig.DigRR) (string, string, uint32) {
+	for _, rr := range answer {
+		owner := ToFQDN(strings.ToLower(rr.Name))
+		if rr.Rtype == "DNAME" && dns.IsSubDomain(owner, name) && owner != name {
+			return "DNAME", strings.TrimSuffix(name, owner) + ToFQDN(strings.ToLower(rr.GetRdata())), rr.Ttl
+		}
+	}
+	for _, rr := range answer {
+		if rr.Rtype == "CNAME" && strings.EqualFold(rr.Name, name) {
+			return "CNAME", ToFQDN(strings.ToLower(rr.GetRdata())), rr.Ttl
+		}
+	}
+	return "", "", 0
+}
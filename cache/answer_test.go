@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+
+	"zonetree/dig"
+)
+
+func TestFindAlias(t *testing.T) {
+	rr := func(name, rtype, rdata string, ttl uint32) dig.DigRR {
+		return dig.DigRR{Name: name, Rtype: rtype, Ttl: ttl, Rdata: []string{rdata}}
+	}
+
+	tests := []struct {
+		name   string
+		qname  string
+		answer []dig.DigRR
+		rtype  string
+		target string
+		ttl    uint32
+	}{
+		{"none", "example.se.", []dig.DigRR{rr("example.se.", "NS", "ns.example.se.", 3600)}, "", "", 0},
+		{"empty", "example.se.", nil, "", "", 0},
+		{"cname at apex", "example.se.", []dig.DigRR{rr("example.se.", "CNAME", "example.net.", 300)},
+			"CNAME", "example.net.", 300},
+		{"cname case", "www.example.se.", []dig.DigRR{rr("WWW.Example.SE.", "CNAME", "Web.Example.NET.", 60)},
+			"CNAME", "web.example.net.", 60},
+		{"cname for another name", "www.example.se.", []dig.DigRR{rr("ftp.example.se.", "CNAME", "example.net.", 60)},
+			"", "", 0},
+		{"dname above", "a.b.example.se.", []dig.DigRR{rr("example.se.", "DNAME", "example.net.", 600)},
+			"DNAME", "a.b.example.net.", 600},
+		{"dname wins over synthesized cname", "www.example.se.", []dig.DigRR{
+			rr("www.example.se.", "CNAME", "www.example.net.", 0),
+			rr("example.se.", "DNAME", "example.net.", 600)},
+			"DNAME", "www.example.net.", 600},
+		{"dname at the name", "example.se.", []dig.DigRR{rr("example.se.", "DNAME", "example.net.", 600)},
+			"", "", 0},
+		{"dname below", "example.se.", []dig.DigRR{rr("sub.example.se.", "DNAME", "example.net.", 600)},
+			"", "", 0},
+		// Only the first hop, the target gets a zone of its own
+		{"chain", "a.example.se.", []dig.DigRR{
+			rr("a.example.se.", "CNAME", "b.example.se.", 60),
+			rr("b.example.se.", "CNAME", "c.example.net.", 120)},
+			"CNAME", "b.example.se.", 60},
+		{"chain, second hop", "b.example.se.", []dig.DigRR{
+			rr("a.example.se.", "CNAME", "b.example.se.", 60),
+			rr("b.example.se.", "CNAME", "c.example.net.", 120)},
+			"CNAME", "c.example.net.", 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtype, target, ttl := findAlias(tt.qname, tt.answer)
+			if rtype != tt.rtype || target != tt.target || ttl != tt.ttl {
+				t.Errorf("findAlias() = %s %s %d, want %s %s %d", rtype, target, ttl, tt.rtype, tt.target, tt.ttl)
+			}
+		})
+	}
+}
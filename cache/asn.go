@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"zonetree/logger"
+)
+
+// Prefix to ASN table in the hints directory, in the format of the
+// routeviews pfx2as files: prefix, length and origin AS(s), tab separated.
+// Multi-origin ASes are separated by "_", AS sets by ",".
+const ASNFile = "pfx2as.txt"
+
+// PrefixTable
+//
+// Longest prefix match from IP to origin AS.
+type PrefixTable struct {
+	asn  map[netip.Prefix]string
+	bits []int // Prefix lengths in the table, longest first
+}
+
+var (
+	asnMu    sync.RWMutex
+	asnTable *PrefixTable
+)
+
+// LoadASNTable
+//
+// Load a prefix to ASN table from the hints directory, and use it for
+// all later annotations. The old table is kept if the new can't be read.
+func LoadASNTable(file string, log logger.Logger) (int, error) {
+	f, err := os.Open(filepath.Join("hints", file))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	t, err := ParsePrefixTable(f, log)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", file, err)
+	}
+
+	asnMu.Lock()
+	asnTable = t
+	asnMu.Unlock()
+
+	return len(t.asn), nil
+}
+
+// ParsePrefixTable
+//
+// Read a routeviews pfx2as style table. Empty lines and lines
+// starting with # are skipped. So are bad lines, which are logged.
+// The origin AS field is kept as is, see Origins.
+// Fails only if the table can't be read, or has no usable lines.
+func ParsePrefixTable(r io.Reader, log logger.Logger) (*PrefixTable, error) {
+	t := &PrefixTable{asn: make(map[netip.Prefix]string)}
+
+	skipped := 0
+	skip := func(line int, err error) {
+		skipped++
+		// Don't drown in errors from a broken file
+		if skipped <= 10 {
+			log.Warn("Skipping bad line in prefix table", "line", line, "Error", err)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		f := strings.Fields(text)
+		if len(f) != 3 {
+			skip(line, fmt.Errorf("expected 3 fields, got %d", len(f)))
+			continue
+		}
+		addr, err := netip.ParseAddr(f[0])
+		if err != nil {
+			skip(line, err)
+			continue
+		}
+		bits, err := strconv.Atoi(f[1])
+		if err != nil {
+			skip(line, err)
+			continue
+		}
+		p, err := addr.Prefix(bits)
+		if err != nil {
+			skip(line, err)
+			continue
+		}
+		t.asn[p] = f[2]
+		if !slices.Contains(t.bits, bits) {
+			t.bits = append(t.bits, bits)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		log.Warn("Skipped bad lines in prefix table", "skipped", skipped, "prefixes", len(t.asn))
+	}
+	if len(t.asn) < 1 && skipped > 0 {
+		return nil, fmt.Errorf("no usable lines, %d bad", skipped)
+	}
+
+	slices.Sort(t.bits)
+	slices.Reverse(t.bits)
+
+	return t, nil
+}
+
+// Origins
+//
+// Split the origin AS field of the table into the origins of the
+// prefix. Multi-origin ASes ("_") are separate origins, an AS set (",")
+// is one, written as {64496,64497}.
+func Origins(asn string) []string {
+	var origins []string
+	for _, o := range strings.Split(asn, "_") {
+		if strings.Contains(o, ",") {
+			o = "{" + o + "}"
+		}
+		if o != "" && !slices.Contains(origins, o) {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+// asLabel
+//
+// Get an origin, see Origins, as text: AS64496 or AS set {64496,64497}
+func asLabel(origin string) string {
+	if strings.HasPrefix(origin, "{") {
+		return "AS set " + origin
+	}
+	return "AS" + origin
+}
+
+// Lookup
+//
+// Get the longest matching prefix, and its origin AS, for ip.
+func (t *PrefixTable) Lookup(ip string) (string, string) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", ""
+	}
+	addr = addr.Unmap()
+	for _, bits := range t.bits {
+		if bits > addr.BitLen() {
+			continue
+		}
+		p, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if asn, ok := t.asn[p]; ok {
+			return p.String(), asn
+		}
+	}
+	return "", ""
+}
+
+// LookupASN
+//
+// Look up ip in the loaded prefix table. Empty if there is no table,
+// or no match.
+func LookupASN(ip string) (string, string) {
+	asnMu.RLock()
+	defer asnMu.RUnlock()
+	if asnTable == nil {
+		return "", ""
+	}
+	return asnTable.Lookup(ip)
+}
+
+func asnLoaded() bool {
+	asnMu.RLock()
+	defer asnMu.RUnlock()
+	return asnTable != nil
+}
+
+// Diversity
+//
+// How spread out the servers of a zone are over the network.
+// Score is the number of the four criteria met: more than one AS,
+// more than one IPv4 /24, more than one IPv6 /48 and both address
+// families. Criteria that can't be checked (no table, no IPv6) count
+// as not met.
+type Diversity struct {
+	Addresses  int      `json:"Addresses"`
+	Prefixes24 int      `json:"Prefixes24"` // Distinct IPv4 /24
+	Prefixes48 int      `json:"Prefixes48"` // Distinct IPv6 /48
+	ASNs       []string `json:"ASNs"`       // Distinct origins, see Origins
+	Families   int      `json:"Families"`
+	Score      int      `json:"Score"`
+	Warnings   []string `json:"Warnings"`
+}
+
+// annotateASN
+//
+// Set Prefix and ASN on all NSIP entries of the zone, and score its
+// diversity.
+func (z *Zone) annotateASN() {
+	for i, ns := range z.NSIP {
+		if ns.IP != "" {
+			z.NSIP[i].Prefix, z.NSIP[i].ASN = LookupASN(ns.IP)
+		}
+	}
+	d := z.AnalyzeDiversity()
+	z.Diversity = &d
+}
+
+// AnalyzeDiversity
+//
+// Score the network diversity of the zone's servers.
+func (z *Zone) AnalyzeDiversity() Diversity {
+	var d Diversity
+
+	p24 := make(map[netip.Prefix]bool)
+	p48 := make(map[netip.Prefix]bool)
+	var v4, v6 bool
+	var seen []string
+	unknown := 0
+
+	for _, ns := range z.NSIP {
+		addr, err := netip.ParseAddr(ns.IP)
+		if err != nil || slices.Contains(seen, ns.IP) {
+			continue
+		}
+		seen = append(seen, ns.IP)
+		addr = addr.Unmap()
+		d.Addresses++
+
+		if addr.Is4() {
+			v4 = true
+			p, _ := addr.Prefix(24)
+			p24[p] = true
+		} else {
+			v6 = true
+			p, _ := addr.Prefix(48)
+			p48[p] = true
+		}
+
+		if ns.ASN == "" {
+			unknown++
+		}
+		for _, o := range Origins(ns.ASN) {
+			if !slices.Contains(d.ASNs, o) {
+				d.ASNs = append(d.ASNs, o)
+			}
+		}
+	}
+	slices.Sort(d.ASNs)
+
+	d.Prefixes24 = len(p24)
+	d.Prefixes48 = len(p48)
+	if v4 {
+		d.Families++
+	}
+	if v6 {
+		d.Families++
+	}
+
+	if d.Addresses < 1 {
+		d.Warnings = append(d.Warnings, "No server addresses")
+		return d
+	}
+
+	if len(d.ASNs) > 1 {
+		d.Score++
+	}
+	if d.Prefixes24 > 1 {
+		d.Score++
+	}
+	if d.Prefixes48 > 1 {
+		d.Score++
+	}
+	if d.Families > 1 {
+		d.Score++
+	}
+
+	switch {
+	case !asnLoaded():
+		d.Warnings = append(d.Warnings, "No prefix to ASN table loaded")
+	case len(d.ASNs) == 1 && unknown == 0:
+		d.Warnings = append(d.Warnings, "All servers in one AS ("+asLabel(d.ASNs[0])+")")
+	case unknown > 0:
+		d.Warnings = append(d.Warnings, fmt.Sprintf("No AS found for %d address(es)", unknown))
+	}
+	if v4 && d.Prefixes24 == 1 {
+		d.Warnings = append(d.Warnings, "All IPv4 addresses in one /24")
+	}
+	if v6 && d.Prefixes48 == 1 {
+		d.Warnings = append(d.Warnings, "All IPv6 addresses in one /48")
+	}
+	if !v4 {
+		d.Warnings = append(d.Warnings, "No IPv4 addresses")
+	}
+	if !v6 {
+		d.Warnings = append(d.Warnings, "No IPv6 addresses")
+	}
+
+	return d
+}
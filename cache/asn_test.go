@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"zonetree/logger"
+)
+
+const testPrefixTable = `# prefix	length	origin
+192.0.2.0	24	64496
+192.0.2.128	25	64497
+198.51.100.0	24	64498_64499
+203.0.113.0	24	64500,64501
+2001:db8::	32	64502
+192.0.2.0	nope	64503
+not-an-ip	24	64504
+10.0.0.0	8
+`
+
+func TestParsePrefixTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    string
+		prefixes int
+		err      bool
+	}{
+		{"bad lines skipped", testPrefixTable, 5, false},
+		{"empty", "", 0, false},
+		{"comments only", "# nothing\n\n", 0, false},
+		{"only bad lines", "192.0.2.0 33 64496\nnope\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt, err := ParsePrefixTable(strings.NewReader(tt.table), logger.DummyLogger{})
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if err == nil && len(pt.asn) != tt.prefixes {
+				t.Errorf("%d prefixes, want %d", len(pt.asn), tt.prefixes)
+			}
+		})
+	}
+}
+
+func TestPrefixTableLookup(t *testing.T) {
+	pt, err := ParsePrefixTable(strings.NewReader(testPrefixTable), logger.DummyLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip      string
+		prefix  string
+		asn     string
+		origins []string
+	}{
+		{"192.0.2.1", "192.0.2.0/24", "64496", []string{"64496"}},
+		{"192.0.2.200", "192.0.2.128/25", "64497", []string{"64497"}}, // Longest match
+		{"::ffff:192.0.2.1", "192.0.2.0/24", "64496", []string{"64496"}},
+		{"198.51.100.1", "198.51.100.0/24", "64498_64499", []string{"64498", "64499"}},
+		{"203.0.113.1", "203.0.113.0/24", "64500,64501", []string{"{64500,64501}"}},
+		{"2001:db8::53", "2001:db8::/32", "64502", []string{"64502"}},
+		{"10.1.1.1", "", "", nil},
+		{"not an ip", "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			prefix, asn := pt.Lookup(tt.ip)
+			if prefix != tt.prefix || asn != tt.asn {
+				t.Errorf("Lookup() = %s, %s, want %s, %s", prefix, asn, tt.prefix, tt.asn)
+			}
+			if got := Origins(asn); !slices.Equal(got, tt.origins) {
+				t.Errorf("Origins() = %v, want %v", got, tt.origins)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"zonetree/dig"
+)
+
+// CompareRun
+//
+// Result of building one name with one profile.
+type CompareRun struct {
+	Profile  string           `json:"Profile"`
+	Opt      Options          `json:"Opt"`
+	Queries  int              `json:"Queries"`  // DNS queries sent
+	Servers  int              `json:"Servers"`  // Distinct server IPs contacted
+	Duration time.Duration    `json:"Duration"` // Wall clock time of the build
+	ZoneCuts []string         `json:"ZoneCuts"` // Result of ZoneCutPath
+	Status   map[string]int32 `json:"Status"`   // Status of each node in the path
+}
+
+// Comparison
+//
+// Side-by-side result of building the same name with several profiles.
+type Comparison struct {
+	Name        string       `json:"Name"`
+	Runs        []CompareRun `json:"Runs"`
+	Differences []string     `json:"Differences"` // Human readable list of what differs between the runs
+}
+
+// Compare
+//
+// Build name once per profile, each with an isolated cache, and compare
+// the results. The runs are done one after another, so that they don't
+// compete for bandwidth and skew the timing.
+func (c *Config) Compare(name string, profiles map[string]Options) Comparison {
+
+	cmp := Comparison{Name: ToFQDN(name)}
+	list := dig.Path(name)
+
+	var names []string
+	for p := range profiles {
+		names = append(names, p)
+	}
+	slices.Sort(names)
+
+	for _, p := range names {
+		rcfg := c.WithOptions(profiles[p]).Isolated()
+		rcfg.Stats = &BuildStats{}
+
+		start := time.Now()
+		BuildZoneCache(name, rcfg)
+
+		run := CompareRun{
+			Profile:  p,
+			Opt:      profiles[p],
+			Queries:  rcfg.Stats.Queries,
+			Servers:  len(rcfg.Stats.Servers),
+			Duration: time.Since(start),
+			ZoneCuts: rcfg.ZoneCutPath(list),
+			Status:   make(map[string]int32),
+		}
+		for _, node := range list {
+			if z, ok := rcfg.Zones.Get(node); ok {
+				run.Status[node] = z.Status
+			}
+		}
+		cmp.Runs = append(cmp.Runs, run)
+	}
+
+	cmp.Differences = compareRuns(list, cmp.Runs)
+
+	return cmp
+}
+
+// compareRuns
+//
+// List zone cut and status differences between the runs, using the first
+// run as reference.
+func compareRuns(list []string, runs []CompareRun) []string {
+	var diff []string
+	if len(runs) < 2 {
+		return diff
+	}
+	ref := runs[0]
+	for _, run := range runs[1:] {
+		if !slices.Equal(ref.ZoneCuts, run.ZoneCuts) {
+			diff = append(diff, fmt.Sprintf("Zone cuts: %s [%s] vs %s [%s]",
+				ref.Profile, strings.Join(ref.ZoneCuts, " "), run.Profile, strings.Join(run.ZoneCuts, " ")))
+		}
+		for _, node := range list {
+			if ref.Status[node] != run.Status[node] {
+				diff = append(diff, fmt.Sprintf("Status of %s: %s %d (%s) vs %s %d (%s)", node,
+					ref.Profile, ref.Status[node], ZoneStatus[ref.Status[node]],
+					run.Profile, run.Status[node], ZoneStatus[run.Status[node]]))
+			}
+		}
+	}
+	return diff
+}
@@ -4,19 +4,24 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"math/rand/v2"
-	"os"
 	"strconv"
+	"sync"
+	"time"
+	"zonetree/dig"
 	"zonetree/logger"
 )
 
 type Config struct {
+	mu           sync.RWMutex // Guards Opt when switching profile
 	Log          logger.Logger
 	Zones        Map[Zone]
 	Cache        Map[Server]
-	IPv4only     bool     `json:"IPv4only"`
-	IPv6only     bool     `json:"IPv6only"`
-	ResolverList []string `json:"ResolverList"`
-	Opt          Options  `json:"Opt"`
+	IPv4only     bool        `json:"IPv4only"`
+	IPv6only     bool        `json:"IPv6only"`
+	ResolverList []string    `json:"ResolverList"`
+	Opt          Options     `json:"Opt"`
+	Stats        *BuildStats // Traffic counters. Nil unless explicitly wanted
+	Port         string      // DNS port of all servers. Empty for 53, only set by tests
 }
 
 // Options
@@ -33,27 +38,68 @@ type Config struct {
 // QminSubtractCache	- Count down on cache hits.
 // QminStrict		- If true, abort on fail rather than falling back to using the full domain name.
 // QminFirstPath	- If true, continue to next label after first successful lookup.
+//
+// The Query-options deal with timing of the individual DNS queries
+// QueryTimeout		- Dial/read/write timeout for each attempt.
+// QueryRetries		- Number of extra attempts when a server does not respond.
+// QueryBackoff		- Wait before the first retry. Doubled for each following retry.
+//
+// QueryApex		- If true, also fetch SOA and DNSKEY from each authoritative server.
+// FollowAlias		- If true, also build the tree of the target when a name is a CNAME/DNAME alias.
+// QueryIdentity	- If true, ask each authoritative server for NSID, hostname.bind, id.server and version.bind.
+// QueryEDNS		- If true, run the EDNS compliance tests against each authoritative server.
+// QueryUDPSize		- If true, measure response sizes and truncation at different UDP buffer sizes.
+// QueryCookies		- If true, check the DNS Cookie support of each authoritative server.
+//
+// UseCookies		- If true, send DNS Cookies with the queries of a build, and remember the server
+//
+//	cookies in the Server cache. Off by default. Probes never send cookies,
+//	other than the ones the cookie check makes up.
 type Options struct {
-	IPv4only          bool     `json:"IPv4only" yaml:"IPv4only"`
-	IPv6only          bool     `json:"IPv6only" yaml:"IPv6only"`
-	ResolverList      []string `json:"ResolverList" yaml:"ResolverList"`
-	QminLabelSequence []int8   `json:"QminLabelSequence" yaml:"QminLabelSequence"`
-	QminSubtractCache bool     `json:"QminSubtractCache" yaml:"QminSubtractCache"`
-	QminStrict        bool     `json:"QminStrict" yaml:"QminStrict"`
-	QminFirstPath     bool     `json:"QminFirstPath" yaml:"QminFirstPath"`
+	IPv4only          bool          `json:"IPv4only" yaml:"IPv4only"`
+	IPv6only          bool          `json:"IPv6only" yaml:"IPv6only"`
+	ResolverList      []string      `json:"ResolverList" yaml:"ResolverList"`
+	QminLabelSequence []int8        `json:"QminLabelSequence" yaml:"QminLabelSequence"`
+	QminSubtractCache bool          `json:"QminSubtractCache" yaml:"QminSubtractCache"`
+	QminStrict        bool          `json:"QminStrict" yaml:"QminStrict"`
+	QminFirstPath     bool          `json:"QminFirstPath" yaml:"QminFirstPath"`
+	QueryTimeout      time.Duration `json:"QueryTimeout" yaml:"QueryTimeout"`
+	QueryRetries      int           `json:"QueryRetries" yaml:"QueryRetries"`
+	QueryBackoff      time.Duration `json:"QueryBackoff" yaml:"QueryBackoff"`
+	QueryApex         bool          `json:"QueryApex" yaml:"QueryApex"`
+	FollowAlias       bool          `json:"FollowAlias" yaml:"FollowAlias"`
+	QueryIdentity     bool          `json:"QueryIdentity" yaml:"QueryIdentity"`
+	QueryEDNS         bool          `json:"QueryEDNS" yaml:"QueryEDNS"`
+	QueryUDPSize      bool          `json:"QueryUDPSize" yaml:"QueryUDPSize"`
+	QueryCookies      bool          `json:"QueryCookies" yaml:"QueryCookies"`
+	UseCookies        bool          `json:"UseCookies" yaml:"UseCookies"`
 }
 
-func Init(log logger.Logger, zc Map[Zone], sc Map[Server]) Config {
-	var conf Config
+func Init(log logger.Logger, zc Map[Zone], sc Map[Server]) *Config {
+	conf := &Config{}
 	conf.Log = log
 	conf.Zones = zc
 	conf.Cache = sc
 
-	var root Zone
-	root.Preload("root-hints.json")
+	conf.DefaultOptions()
+
+	// Optional, for the network diversity analysis
+	if n, err := LoadASNTable(ASNFile, conf.Log); err != nil {
+		conf.Log.Debug("No prefix to ASN table loaded", "file", ASNFile, "Error", err)
+	} else {
+		conf.Log.Info("Loaded prefix to ASN table", "file", ASNFile, "prefixes", n)
+	}
+
+	// Bootstrap from named.root, then replace with live data
+	root, err := LoadRootHints(RootHintsFile)
+	if err != nil {
+		conf.Log.Error("Unable to load ROOT hints", "file", RootHintsFile, "Error", err)
+	}
 	conf.Zones.Set(".", root)
 
-	conf.DefaultOptions()
+	if err := conf.PrimeRoot(); err != nil {
+		conf.Log.Warn("Unable to prime ROOT. Using hints", "Error", err)
+	}
 
 	//conf.Opt.QminFirstPath = true
 
@@ -73,34 +119,91 @@ func (c *Config) DefaultOptions() {
 		QminStrict:        false,
 		QminFirstPath:     false,
 		ResolverList:      []string{"1.1.1.1", "8.8.8.8", "8.8.4.4", "9.9.9.9"},
+		QueryTimeout:      dig.DefaultTimeout,
+		QueryRetries:      1,
+		QueryBackoff:      dig.DefaultBackoff,
 	}
 
 }
 
 // Load
 //
-// Loads a YAML config file, ovverwriting default options.
+// Loads a YAML profile from ProfileDir. The running options are only
+// replaced if the whole profile is valid.
 func (c *Config) Load(file string) error {
 
-	cf, err := os.ReadFile("profiles/" + file)
+	opt, err := ReadProfile(file)
 	if err != nil {
-		fmt.Printf("ReadFile error: %v\n", err)
+		return err
 	}
-	yaml.Unmarshal(cf, &c.Opt)
-	/*
-		if err != nil {
-			fmt.Printf("YAML unmarshal error: %v\n", err)
-		}
-	*/
 
-	return err
+	c.SetOptions(opt)
+
+	return nil
+
+}
+
+// SetOptions
+//
+// Atomically replace the running options.
+// Builds already running keep the options they started with (see Snapshot).
+func (c *Config) SetOptions(opt Options) {
+	c.mu.Lock()
+	c.Opt = opt
+	c.mu.Unlock()
+}
 
+// Snapshot
+//
+// Get a copy of the Config using the options as they are right now.
+// Builds should run on a snapshot, so that a profile switch halfway
+// through does not give them a mix of old and new options.
+func (c *Config) Snapshot() *Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return &Config{
+		Log:          c.Log,
+		Zones:        c.Zones,
+		Cache:        c.Cache,
+		IPv4only:     c.IPv4only,
+		IPv6only:     c.IPv6only,
+		ResolverList: c.ResolverList,
+		Opt:          c.Opt,
+		Stats:        c.Stats,
+		Port:         c.Port,
+	}
+}
+
+// WithOptions
+//
+// Get a snapshot of the Config that uses opt instead of the running options.
+// Caches are still shared with c.
+func (c *Config) WithOptions(opt Options) *Config {
+	n := c.Snapshot()
+	n.Opt = opt
+	return n
+}
+
+// Isolated
+//
+// Get a snapshot of the Config with its own, empty, Zone and Server caches.
+// Only the ROOT zone is copied over, since nothing works without it.
+func (c *Config) Isolated() *Config {
+	n := c.Snapshot()
+	n.Zones = NewZoneCache()
+	n.Cache = NewServerCache()
+	if root, ok := c.Zones.Get("."); ok {
+		n.Zones.Set(".", root)
+	}
+	return n
 }
 
 // RunningConf
 //
 // Prints out the current loaded conf in YAML format.
 func (c *Config) RunningConf() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	cnf, err := yaml.Marshal(&c.Opt)
 	if err != nil {
 		fmt.Printf("YAML marshal error: %v\n", err)
@@ -124,16 +227,17 @@ func PrepZone(name string, cfg *Config) (Zone, error) {
 	var zone Zone
 	cfg.Log.Debug("Prepping zone", "zone", name)
 	// Try to get zone from concurrent map
-	if zone, ok := cfg.Zones.Get(name); ok {
+	cached, ok := cfg.Zones.Get(name)
+	if ok {
 		cfg.Log.Debug("Found zone in cache", "zone", name)
-		// If the zone is fully primed (200), return it.
-		if zone.Status == 200 {
-			cfg.Log.Debug("Zone ready", "zone", name, "status", strconv.FormatInt(int64(zone.Status), 10))
-			return zone, nil
+		// If the zone is fully primed (200), or an alias (301), return it.
+		if cached.Ready() {
+			cfg.Log.Debug("Zone ready", "zone", name, "status", strconv.FormatInt(int64(cached.Status), 10))
+			return cached, nil
 		}
 
 		// Otherwise, start checking and adding info to zone object
-		cfg.Log.Debug("Zone not ready", "zone", name, "status", strconv.FormatInt(int64(zone.Status), 10))
+		cfg.Log.Debug("Zone not ready", "zone", name, "status", strconv.FormatInt(int64(cached.Status), 10))
 	}
 	// If zone is not in cache at all, create a new zone and try to populate it
 	cfg.Log.Debug("Creating placeholder for zone", "zone", name)
@@ -153,8 +257,9 @@ func PrepZone(name string, cfg *Config) (Zone, error) {
 	// Populate the parent nameserver info
 	// If the option for First Path is set, stop going through the list
 	// as soon as enough information to continue down the tree is obtaine
-	for ip, name := range nslist {
-		pds := zone.QueryParentForDelegation(ip, name, cfg)
+	// Fastest servers first, see OrderByRTT
+	for _, ip := range cfg.OrderByRTT(nslist) {
+		pds := zone.QueryParentForDelegation(ip, nslist[ip], cfg)
 		if pds == 200 && cfg.Opt.QminFirstPath {
 			break
 		}
@@ -180,10 +285,39 @@ func PrepZone(name string, cfg *Config) (Zone, error) {
 		cfg.Log.Debug("Error doing QuerySelfForNS()", "ERROR", err)
 	}
 
+	// Keep what an imported zone file said, if the parent agrees
+	zone.keepImported(cached)
+
+	if zone.Status == 200 {
+		zone.analyze(cfg, zonecut)
+	}
+
 	return zone, err
 
 }
 
+// analyze
+//
+// Check the glue against the NS set, and what the zone itself serves,
+// annotate the servers with prefix and ASN, and run the probes the
+// options ask for. parent is the zone the delegation came from.
+func (z *Zone) analyze(cfg *Config, parent string) {
+	z.Glue = z.AnalyzeGlue(parent)
+	z.annotateASN()
+	if cfg.Opt.QueryIdentity {
+		z.ProbeIdentity(cfg)
+	}
+	if cfg.Opt.QueryEDNS {
+		z.ProbeEDNS(cfg)
+	}
+	if cfg.Opt.QueryUDPSize {
+		z.ProbeUDPSize(cfg)
+	}
+	if cfg.Opt.QueryCookies {
+		z.ProbeCookies(cfg)
+	}
+}
+
 // Move to Zones
 func Nameservers(ZoneName string, cfg *Config) (map[string]string, string, error) {
 	// Try to get the zone from cache
@@ -206,6 +340,12 @@ func Nameservers(ZoneName string, cfg *Config) (map[string]string, string, error
 			if tpz, ok := cfg.Zones.Get(zone.ZoneCut); ok {
 				zone = tpz
 			}
+		case 301:
+			// Alias. Names below it belong to the zone the alias is in
+			cfg.Log.Debug("Alias", "zone", zone.Name, "target", zone.Alias)
+			if tpz, ok := cfg.Zones.Get(zone.ZoneCut); ok {
+				zone = tpz
+			}
 		case 404:
 			// Not a proper zone. Check ZoneCut
 			cfg.Log.Debug("NXDOMAIN", "zone", zone.Name, "status", strconv.FormatInt(int64(zone.Status), 10))
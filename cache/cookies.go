@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"zonetree/dig"
+)
+
+// DNS Cookies (RFC 7873, RFC 9018). Sizes in hex digits.
+const (
+	clientCookieLen    = 16 // 8 bytes
+	minServerCookieLen = 16 // 8 bytes
+	maxServerCookieLen = 64 // 32 bytes
+)
+
+// Secret for the client cookies. New for each run, so old server
+// cookies are worthless after a restart anyway.
+var cookieSecret = func() []byte {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}()
+
+// clientCookie
+//
+// Get the client cookie for the server at ip. The same for every
+// query to ip, different for every server (RFC 7873 section 4.1).
+func clientCookie(ip string) string {
+	h := hmac.New(sha256.New, cookieSecret)
+	h.Write([]byte(ip))
+	return hex.EncodeToString(h.Sum(nil)[:clientCookieLen/2])
+}
+
+// cookie
+//
+// Get the cookie to send to ip of the nameserver name: the client
+// cookie, and the last server cookie from it, if any.
+func (c *Config) cookie(name, ip string) string {
+	cc := clientCookie(ip)
+	if s, ok := c.Cache.Get(name); ok {
+		return cc + s.Cookie[ip]
+	}
+	return cc
+}
+
+// rememberCookie
+//
+// Store the server cookie from a response from ip in the Server
+// cache entry of the nameserver name. Cookies not meant for us, or
+// of the wrong size, are ignored.
+func (c *Config) rememberCookie(name, ip, cookie string) {
+	sc, ok := strings.CutPrefix(cookie, clientCookie(ip))
+	if name == "" || !ok || len(sc) < minServerCookieLen || len(sc) > maxServerCookieLen {
+		return
+	}
+	c.Cache.Upsert(name, Server{}, func(exist bool, s Server, _ Server) Server {
+		// Copy the map, since readers may hold the old value
+		cookies := make(map[string]string, len(s.Cookie)+1)
+		for k, v := range s.Cookie {
+			cookies[k] = v
+		}
+		cookies[ip] = sc
+		s.Cookie = cookies
+		return s
+	})
+}
+
+// withCookie
+//
+// Add the cookie for the server to q, if UseCookies is set and the
+// query has none, call send and remember the server cookie in the
+// response. send returns the rcode and cookie of the response.
+// On BADCOOKIE the query is sent once more, with the fresh server cookie.
+func (c *Config) withCookie(q *dig.Query, name string, send func() (string, string)) {
+	if !c.Opt.UseCookies || q.NoEdns || q.Cookie != "" || q.Nameserver == "" {
+		send()
+		return
+	}
+	for attempt := 0; ; attempt++ {
+		q.Cookie = c.cookie(name, q.Nameserver)
+		rcode, cookie := send()
+		c.rememberCookie(name, q.Nameserver, cookie)
+		if rcode != "BADCOOKIE" || attempt > 0 {
+			return
+		}
+	}
+}
+
+// Cookie tests
+const (
+	CookieClient    = "client"    // Client cookie only. Expects a server cookie back
+	CookieServer    = "server"    // Client and server cookie from the first test
+	CookieBadServer = "badserver" // Made up server cookie. Expects a new one
+	CookieMalformed = "malformed" // Too short client cookie. Expects FORMERR
+)
+
+// CookieResult
+//
+// DNS Cookie support of one server. RFC9018 is set if the server
+// cookie is in the interoperable format of RFC 9018, which anycast
+// instances can share.
+type CookieResult struct {
+	Name         string     `json:"Name"`
+	IP           string     `json:"IP"`
+	Supported    bool       `json:"Supported"`
+	ServerCookie string     `json:"ServerCookie,omitempty"`
+	RFC9018      bool       `json:"RFC9018"`
+	Tests        []EdnsTest `json:"Tests"`
+	Warnings     []string   `json:"Warnings"`
+}
+
+// ProbeCookies
+//
+// Check the DNS Cookie support of each server of the zone, and store
+// the results on the zone.
+func (z *Zone) ProbeCookies(cfg *Config) {
+	z.Cookies = nil
+	var seen []string
+	for _, ns := range z.NSIP {
+		if !cfg.probeable(ns) || slices.Contains(seen, ns.IP) {
+			continue
+		}
+		seen = append(seen, ns.IP)
+		z.Cookies = append(z.Cookies, cfg.Cookies(ns.Name, ns.IP, z.Name))
+	}
+}
+
+// Cookies
+//
+// Check the DNS Cookie support of the server at ip, with SOA queries
+// for zone. A server cookie that passes is remembered, like in Query.
+func (c *Config) Cookies(name, ip, zone string) CookieResult {
+	r := CookieResult{Name: name, IP: ip}
+	cc := clientCookie(ip)
+
+	q := c.NewQuery()
+	q.Nameserver = ip
+	q.Qname = zone
+	q.Qtype = "SOA"
+
+	send := func(test, cookie string, check func(msg *dns.Msg) string) *dns.Msg {
+		q.Cookie = cookie
+		t := EdnsTest{Test: test, Result: EdnsOK}
+		out, err := probe(q)
+		if err != nil {
+			t.Result = errResult(err)
+			t.Detail = err.Error()
+			r.Tests = append(r.Tests, t)
+			return nil
+		}
+		if t.Detail = check(out.Response); t.Detail != "" {
+			t.Result = EdnsFail
+		}
+		r.Tests = append(r.Tests, t)
+		return out.Response
+	}
+
+	// A good answer has our client cookie and a server cookie of the right size
+	echoed := func(msg *dns.Msg, rcodes ...int) string {
+		if !slices.Contains(rcodes, msg.Rcode) {
+			return "unexpected " + rcodeString(msg.Rcode)
+		}
+		cookie := dig.Cookie(msg)
+		if cookie == "" {
+			return "no cookie in response"
+		}
+		sc, ok := strings.CutPrefix(cookie, cc)
+		if !ok {
+			return "client cookie not echoed"
+		}
+		if len(sc) < minServerCookieLen || len(sc) > maxServerCookieLen {
+			return fmt.Sprintf("server cookie of %d bytes", len(sc)/2)
+		}
+		return ""
+	}
+
+	msg := send(CookieClient, cc, func(msg *dns.Msg) string {
+		return echoed(msg, dns.RcodeSuccess)
+	})
+	if msg == nil {
+		r.Warnings = []string{"No usable response: " + r.Tests[0].Detail}
+		return r
+	}
+	r.Supported = dig.Cookie(msg) != ""
+	if !r.Supported {
+		r.Warnings = r.warnings()
+		return r
+	}
+	r.ServerCookie = strings.TrimPrefix(dig.Cookie(msg), cc)
+
+	if msg := send(CookieServer, cc+r.ServerCookie, func(msg *dns.Msg) string {
+		return echoed(msg, dns.RcodeSuccess)
+	}); msg != nil {
+		c.rememberCookie(name, ip, dig.Cookie(msg))
+	}
+
+	// RFC 7873 section 5.2.3: an invalid server cookie is treated as if
+	// there was only a client cookie, or gets BADCOOKIE
+	bad := make([]byte, 16)
+	rand.Read(bad)
+	send(CookieBadServer, cc+hex.EncodeToString(bad), func(msg *dns.Msg) string {
+		return echoed(msg, dns.RcodeSuccess, dns.RcodeBadCookie)
+	})
+
+	send(CookieMalformed, cc[:10], func(msg *dns.Msg) string {
+		if msg.Rcode != dns.RcodeFormatError {
+			return "expected FORMERR, got " + rcodeString(msg.Rcode)
+		}
+		return ""
+	})
+
+	r.Warnings = r.warnings()
+
+	c.Log.Debug("DNS Cookies", "Server", name, "IP", ip, "Supported", r.Supported, "Warnings", r.Warnings)
+
+	return r
+}
+
+// warnings
+//
+// Explain what is wrong with the results, and check the format of
+// the server cookie.
+func (r *CookieResult) warnings() []string {
+	var w []string
+
+	if !r.Supported {
+		return append(w, "DNS Cookies not supported")
+	}
+	for _, t := range r.Tests {
+		if t.Result != EdnsOK {
+			w = append(w, t.Test+": "+t.Detail)
+		}
+	}
+
+	// RFC 9018: version 1, 3 reserved bytes, 4 byte timestamp, 8 byte hash
+	b, err := hex.DecodeString(r.ServerCookie)
+	if err != nil || len(b) != 16 || b[0] != 1 || b[1] != 0 || b[2] != 0 || b[3] != 0 {
+		return append(w, "Server cookie not in RFC 9018 format")
+	}
+	r.RFC9018 = true
+	ts := time.Unix(int64(binary.BigEndian.Uint32(b[4:8])), 0)
+	if d := time.Since(ts).Round(time.Second); d > time.Hour || d < -5*time.Minute {
+		w = append(w, "Server cookie timestamp off by "+d.String())
+	}
+
+	return w
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieWarnings(t *testing.T) {
+	// RFC 9018 server cookie with timestamp ts
+	rfc9018 := func(ts time.Time) string {
+		b := make([]byte, 16)
+		b[0] = 1
+		binary.BigEndian.PutUint32(b[4:8], uint32(ts.Unix()))
+		return hex.EncodeToString(b)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		r       CookieResult
+		warns   []string
+		rfc9018 bool
+	}{
+		{"not supported", CookieResult{}, []string{"DNS Cookies not supported"}, false},
+		{"rfc 9018", CookieResult{Supported: true, ServerCookie: rfc9018(now)}, nil, true},
+		{"own format", CookieResult{Supported: true, ServerCookie: "0123456789abcdef"},
+			[]string{"Server cookie not in RFC 9018 format"}, false},
+		{"wrong version", CookieResult{Supported: true, ServerCookie: "02" + rfc9018(now)[2:]},
+			[]string{"Server cookie not in RFC 9018 format"}, false},
+		{"old timestamp", CookieResult{Supported: true, ServerCookie: rfc9018(now.Add(-2 * time.Hour))},
+			[]string{"Server cookie timestamp off by 2h0m"}, true},
+		{"failed test", CookieResult{Supported: true, ServerCookie: rfc9018(now),
+			Tests: []EdnsTest{{Test: CookieClient, Result: EdnsOK}, {Test: CookieMalformed, Result: EdnsFail, Detail: "expected FORMERR, got NOERROR"}}},
+			[]string{"malformed: expected FORMERR, got NOERROR"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.r
+			// Prefix match, the timestamp check is not to the second
+			got := r.warnings()
+			if len(got) != len(tt.warns) {
+				t.Fatalf("warnings() = %q, want %q", got, tt.warns)
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], tt.warns[i]) {
+					t.Errorf("warnings() = %q, want %q", got, tt.warns)
+				}
+			}
+			if r.RFC9018 != tt.rfc9018 {
+				t.Errorf("RFC9018 = %v, want %v", r.RFC9018, tt.rfc9018)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	maxCycleLength     = 8 // Longest NS dependency cycle to look for
+	maxDependencyDepth = 4 // How deep to build NS name paths when checking a zone
+)
+
+// needs
+//
+// Get the zones that have to resolve before the servers of cut can be
+// found. Servers with glue need nothing more than the parent.
+func (ds depSet) needs(cut string) []string {
+	dz, ok := ds.zones[cut]
+	if !ok {
+		return nil
+	}
+	var needs []string
+	for _, s := range dz.servers {
+		host := ds.hosts[s]
+		if host == "" || host == "." || slices.Contains(dz.glue, s) {
+			continue
+		}
+		if !slices.Contains(needs, host) {
+			needs = append(needs, host)
+		}
+	}
+	slices.Sort(needs)
+	return needs
+}
+
+// cycles
+//
+// Find all circular NS dependencies between the zones of the set.
+// A cycle is listed as the zones in order, ending with the first zone
+// again. E.g. [a.com. b.net. a.com.] for a zone a.com. served by ns.b.net.
+// and b.net. served by ns.a.com., neither with glue.
+// A zone served by in-domain names without glue is a cycle of its own.
+func (ds depSet) cycles() [][]string {
+	var cycles [][]string
+
+	var walk func(start string, path []string)
+	walk = func(start string, path []string) {
+		if len(path) > maxCycleLength {
+			return
+		}
+		for _, next := range ds.needs(path[len(path)-1]) {
+			if next == start {
+				cycles = append(cycles, append(slices.Clone(path), start))
+				continue
+			}
+			// Only walk zones sorting after start, so that each cycle is
+			// found once, from its lowest zone
+			if next < start || slices.Contains(path, next) {
+				continue
+			}
+			walk(start, append(path, next))
+		}
+	}
+
+	for _, cut := range slices.Sorted(maps.Keys(ds.zones)) {
+		walk(cut, []string{cut})
+	}
+
+	return cycles
+}
+
+// checkCircular
+//
+// Check if a zone can be resolved at all. If some of its servers could
+// not be found, or none of them answered, the paths of its NS names are
+// built, and the NS dependencies between the zones involved are checked
+// for cycles. Zones that can't be resolved without glue they don't have,
+// or only through a cycle, get status 508.
+// Servers found only through the resolver (NSIP.Resolved) may hide a
+// cycle, so those zones are checked too. Their cycles are recorded, but
+// as the servers did answer, the status is kept.
+func (c *Config) checkCircular(cut string, depth int) {
+
+	// Only delegated zones with servers to find
+	z, ok := c.Zones.Get(cut)
+	if !ok || cut == "." || (z.Status != 200 && z.Status != 508) || len(z.NSIP) < 1 {
+		return
+	}
+
+	missing := false
+	answered := false
+	resolved := false
+	for _, ns := range z.NSIP {
+		if ns.IP == "" {
+			missing = true
+		}
+		if ns.Resolved {
+			resolved = true
+		}
+		if ns.ZoneStatus == 200 {
+			answered = true
+		}
+	}
+	if answered && !missing && !resolved {
+		return
+	}
+
+	if depth < maxDependencyDepth {
+		names, _ := z.servers("")
+		for _, name := range names {
+			if !dns.IsSubDomain(cut, name) {
+				buildZoneCache(name, c, depth+1)
+			}
+		}
+	}
+
+	ds := c.collect(cut, false)
+	var cycles [][]string
+	for _, cycle := range ds.cycles() {
+		if slices.Contains(cycle, cut) {
+			cycles = append(cycles, cycle)
+		}
+	}
+
+	z.Cycles = cycles
+	if (missing || !answered) && !ds.resolvable(cut, "") {
+		c.Log.Debug("Zone not resolvable", "zone", cut, "cycles", cycles)
+		z.Status = 508
+	}
+	c.Zones.Set(cut, z)
+}
+
+// CycleString
+//
+// Format a cycle for humans, e.g. "a.com. -> b.net. -> a.com."
+func CycleString(cycle []string) string {
+	return strings.Join(cycle, " -> ")
+}
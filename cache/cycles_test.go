@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckCircular(t *testing.T) {
+	// 127.0.0.1 serves test. (and is the resolver, that knows nothing).
+	// a.test. and b.test. are served by a name in the other one, without
+	// glue. c.test. has glue, but its servers also list ns.a.test.
+	handler := func(ip string, q dns.Question) testAnswer {
+		switch ip + " " + q.Name + " " + dns.TypeToString[q.Qtype] {
+		case "127.0.0.1 a.test. SOA":
+			return testAnswer{Ns: []string{"a.test. 3600 IN NS ns.b.test."}}
+		case "127.0.0.1 b.test. SOA":
+			return testAnswer{Ns: []string{"b.test. 3600 IN NS ns.a.test."}}
+		case "127.0.0.1 c.test. SOA":
+			return testAnswer{
+				Ns:    []string{"c.test. 3600 IN NS ns1.c.test."},
+				Extra: []string{"ns1.c.test. 3600 IN A 127.0.0.3"},
+			}
+		case "127.0.0.3 c.test. NS":
+			return testAnswer{AA: true,
+				Answer: []string{"c.test. 3600 IN NS ns1.c.test.", "c.test. 3600 IN NS ns.a.test."},
+				Extra:  []string{"ns1.c.test. 3600 IN A 127.0.0.3"},
+			}
+		}
+		return testAnswer{Rcode: dns.RcodeServerFailure}
+	}
+
+	cfg := testConfig(t, handler, "127.0.0.1", "127.0.0.3")
+	cfg.Zones.Set("test.", testZone("test.", "ns.test. 127.0.0.1"))
+
+	BuildZoneCache("a.test.", cfg)
+	BuildZoneCache("c.test.", cfg)
+
+	cycle := []string{"a.test.", "b.test.", "a.test."}
+	tests := []struct {
+		zone   string
+		status int32
+		cycles [][]string
+		nsip   []string // Servers without address
+	}{
+		{"a.test.", 508, [][]string{cycle}, []string{"ns.b.test."}},
+		{"b.test.", 508, [][]string{cycle}, []string{"ns.a.test."}},
+		// ns.a.test. can't be found, but ns1.c.test. is enough
+		{"c.test.", 200, nil, []string{"ns.a.test."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			z, ok := cfg.Zones.Get(tt.zone)
+			if !ok {
+				t.Fatal("not in cache")
+			}
+			if z.Status != tt.status {
+				t.Errorf("Status = %d, want %d", z.Status, tt.status)
+			}
+			if !slices.EqualFunc(z.Cycles, tt.cycles, slices.Equal) {
+				t.Errorf("Cycles = %q, want %q", z.Cycles, tt.cycles)
+			}
+			var noip []string
+			for _, ns := range z.NSIP {
+				if ns.IP == "" {
+					noip = append(noip, ns.Name)
+				}
+			}
+			if !slices.Equal(noip, tt.nsip) {
+				t.Errorf("servers without address = %q, want %q", noip, tt.nsip)
+			}
+		})
+	}
+
+	// The name without address is kept where it was found:
+	// the delegation of a.test., the NS set of c.test. itself
+	a, _ := cfg.Zones.Get("a.test.")
+	if len(a.ParentNS) != 1 || !slices.Equal(a.nsNames(a.ParentNS[0].NS), []string{"ns.b.test."}) {
+		t.Errorf("a.test. ParentNS = %+v", a.ParentNS)
+	}
+	c, _ := cfg.Zones.Get("c.test.")
+	if len(c.ZoneNS) != 1 || !slices.Equal(c.nsNames(c.ZoneNS[0].NS), []string{"ns.a.test.", "ns1.c.test."}) {
+		t.Errorf("c.test. ZoneNS = %+v", c.ZoneNS)
+	}
+}
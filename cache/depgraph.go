@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"zonetree/dig"
+)
+
+// Max number of zones to pull into a dependency graph
+const maxDependencyZones = 500
+
+// GraphNode
+//
+// A zone or a nameserver (by name) in a dependency graph.
+type GraphNode struct {
+	ID     string `json:"ID"`   // Kind:Name
+	Kind   string `json:"Kind"` // zone or server
+	Name   string `json:"Name"`
+	Status int32  `json:"Status"` // Zone status. Zero for servers
+}
+
+// GraphEdge
+//
+// From depends on To.
+// Kinds are:
+// delegation	- zone is delegated from (parent) zone
+// served-by	- zone is served by server
+// hosted-in	- name of server is in zone
+type GraphEdge struct {
+	From string `json:"From"`
+	To   string `json:"To"`
+	Kind string `json:"Kind"`
+}
+
+// DependencyGraph
+//
+// Everything the resolution of Name depends on. Zones on the path to
+// Name, the servers of those zones, the zones the server names are in,
+// their servers, and so on.
+// SPOF lists the nodes that on their own make Name unresolvable if
+// they fail. Zones on the path of Name itself are needed by definition,
+// and are not listed.
+type DependencyGraph struct {
+	Name      string      `json:"Name"`
+	Zone      string      `json:"Zone"` // Closest zone cut of Name
+	Nodes     []GraphNode `json:"Nodes"`
+	Edges     []GraphEdge `json:"Edges"`
+	Zones     int         `json:"Zones"`   // Total number of zones Name depends on
+	Servers   int         `json:"Servers"` // Total number of server names Name depends on
+	SPOF      []string    `json:"SPOF"`
+	Cycles    [][]string  `json:"Cycles"`    // Circular NS dependencies between zones, see depSet.cycles
+	Truncated bool        `json:"Truncated"` // Stopped at maxDependencyZones
+}
+
+// depZone
+//
+// What resolution of a zone needs: its parent, and at least one server.
+// Servers in glue can be found through the parent alone.
+type depZone struct {
+	parent  string
+	servers []string
+	glue    []string
+	unknown bool // Not in cache
+}
+
+// depSet
+//
+// Zones and server names collected for a dependency graph.
+// hosts maps server names to the zone cut their name is in.
+// Empty if not known (not in cache).
+type depSet struct {
+	zones     map[string]*depZone
+	hosts     map[string]string
+	leaf      string // Closest zone cut of the name collected for
+	truncated bool
+}
+
+// Dependencies
+//
+// Build the transitive dependency graph for name. The path of name is
+// built, then the path of every NS name found on it, and so on, until
+// no new zones turn up. The servers of the ROOT are known from the hints,
+// so their names are not followed.
+func (c *Config) Dependencies(name string) DependencyGraph {
+
+	name = ToFQDN(strings.ToLower(name))
+	return c.dependencyGraph(name, c.collect(name, true))
+}
+
+// dependencyGraph
+//
+// Turn the zones collected for name into a graph, and find the
+// single points of failure.
+func (c *Config) dependencyGraph(name string, ds depSet) DependencyGraph {
+
+	g := DependencyGraph{Name: name, Zone: ds.leaf, Truncated: ds.truncated}
+
+	// Nodes and edges, in a stable order
+	for _, cut := range slices.Sorted(maps.Keys(ds.zones)) {
+		dz := ds.zones[cut]
+		var status int32
+		if z, ok := c.Zones.Get(cut); ok {
+			status = z.Status
+		}
+		g.Nodes = append(g.Nodes, GraphNode{ID: "zone:" + cut, Kind: "zone", Name: cut, Status: status})
+		if dz.parent != "" {
+			g.Edges = append(g.Edges, GraphEdge{From: "zone:" + cut, To: "zone:" + dz.parent, Kind: "delegation"})
+		}
+		for _, s := range dz.servers {
+			g.Edges = append(g.Edges, GraphEdge{From: "zone:" + cut, To: "server:" + s, Kind: "served-by"})
+		}
+	}
+	var servers []string
+	for _, dz := range ds.zones {
+		servers = append(servers, dz.servers...)
+	}
+	slices.Sort(servers)
+	servers = slices.Compact(servers)
+	for _, s := range servers {
+		g.Nodes = append(g.Nodes, GraphNode{ID: "server:" + s, Kind: "server", Name: s})
+		if host := ds.hosts[s]; host != "" {
+			g.Edges = append(g.Edges, GraphEdge{From: "server:" + s, To: "zone:" + host, Kind: "hosted-in"})
+		}
+	}
+
+	g.Zones = len(ds.zones)
+	g.Servers = len(servers)
+	g.Cycles = ds.cycles()
+
+	// Single points of failure. Fail one node at a time, and see if
+	// name can still be resolved.
+	path := append([]string{"."}, c.ZoneCutPath(dig.Path(name))...)
+	for _, node := range g.Nodes {
+		if node.Kind == "zone" && slices.Contains(path, node.Name) {
+			continue
+		}
+		if !ds.resolvable(g.Zone, node.ID) {
+			g.SPOF = append(g.SPOF, node.ID)
+		}
+	}
+
+	return g
+}
+
+// collect
+//
+// Collect the zones name depends on, and the zones the names of their
+// servers are in, and so on. With build set, paths are built with
+// BuildZoneCache as needed. Otherwise only what is already in the cache
+// is used.
+func (c *Config) collect(name string, build bool) depSet {
+
+	ds := depSet{zones: make(map[string]*depZone), hosts: make(map[string]string)}
+	queue := []string{name}
+	queued := map[string]bool{name: true}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		if len(ds.zones) >= maxDependencyZones {
+			ds.truncated = true
+			break
+		}
+
+		if build {
+			BuildZoneCache(n, c)
+		} else if _, ok := c.Zones.Get(n); !ok && n != name {
+			// Path not in cache. Where the name lives is unknown
+			continue
+		}
+		cuts := append([]string{"."}, c.ZoneCutPath(dig.Path(n))...)
+		leaf := cuts[len(cuts)-1]
+		if n == name {
+			ds.leaf = leaf
+		} else {
+			ds.hosts[n] = leaf
+		}
+
+		for i, cut := range cuts {
+			if _, ok := ds.zones[cut]; ok {
+				continue
+			}
+			dz := &depZone{}
+			if i > 0 {
+				dz.parent = cuts[i-1]
+			}
+			ds.zones[cut] = dz
+
+			z, ok := c.Zones.Get(cut)
+			if !ok {
+				dz.unknown = true
+				continue
+			}
+			dz.servers, dz.glue = z.servers(dz.parent)
+			if cut == "." {
+				continue
+			}
+			for _, s := range dz.servers {
+				if !queued[s] {
+					queued[s] = true
+					queue = append(queue, s)
+				}
+			}
+		}
+	}
+
+	return ds
+}
+
+// servers
+//
+// Get the sorted, unique, NS names of the zone, and the ones of them
+// that the parent zone gave glue for.
+func (z *Zone) servers(parent string) ([]string, []string) {
+	var names, glue []string
+	for _, ns := range z.NSIP {
+		if ns.Name != "" {
+			names = append(names, strings.ToLower(ns.Name))
+		}
+	}
+	for _, p := range z.ParentNS {
+		if p.ChildStatus != 200 {
+			continue
+		}
+		for _, id := range p.NS {
+			ns := z.nsip(id)
+			if ns.IP != "" && parent != "" && dns.IsSubDomain(parent, ns.Name) {
+				glue = append(glue, strings.ToLower(ns.Name))
+			}
+		}
+	}
+	slices.Sort(names)
+	slices.Sort(glue)
+	return slices.Compact(names), slices.Compact(glue)
+}
+
+// resolvable
+//
+// Check if zone can be resolved when the node with ID failed is down.
+func (ds depSet) resolvable(zone, failed string) bool {
+	return ds.resolved(func(id string) bool { return id == failed })[zone]
+}
+
+// resolved
+//
+// Get the zones that can be resolved, when the nodes failed returns
+// true for (by ID, zone:name or server:name) are down.
+// A zone resolves if its parent does, and at least one of its servers is
+// up and can be found. A server can be found if there is glue for it,
+// or the zone its name is in resolves. Zones not in cache, and servers
+// in zones not known, are given the benefit of the doubt.
+// Starts with nothing resolvable, and repeats until nothing changes.
+func (ds depSet) resolved(failed func(id string) bool) map[string]bool {
+
+	ok := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for cut, dz := range ds.zones {
+			if ok[cut] || failed("zone:"+cut) {
+				continue
+			}
+			if dz.parent != "" && !ok[dz.parent] {
+				continue
+			}
+			if dz.unknown {
+				ok[cut] = true
+				changed = true
+				continue
+			}
+			for _, s := range dz.servers {
+				if failed("server:" + s) {
+					continue
+				}
+				// ROOT servers come from the hints
+				host := ds.hosts[s]
+				if cut == "." || slices.Contains(dz.glue, s) || host == "" || ok[host] {
+					ok[cut] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return ok
+}
+
+// Dot
+//
+// Render the graph in Graphviz DOT format.
+func (g DependencyGraph) Dot() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %q {\n", g.Name)
+	for _, n := range g.Nodes {
+		shape := "ellipse"
+		if n.Kind == "zone" {
+			shape = "box"
+		}
+		color := "black"
+		if slices.Contains(g.SPOF, n.ID) {
+			color = "red"
+		}
+		fmt.Fprintf(&b, "  %q [label=%q shape=%s color=%s];\n", n.ID, n.Name, shape, color)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", e.From, e.To, e.Kind)
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
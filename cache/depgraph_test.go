@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"zonetree/logger"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	cfg := &Config{Log: logger.DummyLogger{}, Zones: NewZoneCache(), Cache: NewServerCache()}
+	for _, z := range []Zone{
+		testZone(".", "a.root-servers.net. 198.41.0.4", "b.root-servers.net. 170.247.170.2"),
+		testZone("se.", "a.ns.se. 192.0.2.1", "b.ns.se. 192.0.2.2"),
+		testZone("net.", "a.gtld-servers.net. 192.0.2.10"),
+		// Two servers, but both in provider.net., and no glue
+		testZone("example.se.", "ns1.provider.net. 203.0.113.1", "ns2.provider.net. 203.0.113.2"),
+		testZone("provider.net.", "ns.provider.net. 203.0.113.53"),
+		testHost("ns1.provider.net.", "provider.net."),
+		testHost("ns2.provider.net.", "provider.net."),
+	} {
+		cfg.Zones.Set(z.Name, z)
+	}
+
+	g := cfg.dependencyGraph("example.se.", cfg.collect("example.se.", false))
+
+	// The path of example.se. itself is left out. So are servers with a stand-in.
+	spof := []string{"zone:net.", "zone:provider.net.", "server:a.gtld-servers.net.", "server:ns.provider.net."}
+	if !slices.Equal(g.SPOF, spof) {
+		t.Errorf("SPOF = %q, want %q", g.SPOF, spof)
+	}
+	if g.Zone != "example.se." || g.Zones != 5 || g.Servers != 8 || g.Truncated || len(g.Cycles) > 0 {
+		t.Errorf("Zone %s, %d zones, %d servers, truncated %v, cycles %v, want example.se., 5, 8, false, none",
+			g.Zone, g.Zones, g.Servers, g.Truncated, g.Cycles)
+	}
+
+	dot := g.Dot()
+	for _, line := range []string{
+		`digraph "example.se." {`,
+		`  "zone:net." [label="net." shape=box color=red];`,
+		`  "zone:se." [label="se." shape=box color=black];`,
+		`  "server:ns.provider.net." [label="ns.provider.net." shape=ellipse color=red];`,
+		`  "server:ns1.provider.net." [label="ns1.provider.net." shape=ellipse color=black];`,
+		`  "zone:example.se." -> "zone:se." [label="delegation"];`,
+		`  "zone:example.se." -> "server:ns1.provider.net." [label="served-by"];`,
+		`  "server:ns1.provider.net." -> "zone:provider.net." [label="hosted-in"];`,
+		`}`,
+	} {
+		if !slices.Contains(strings.Split(dot, "\n"), line) {
+			t.Errorf("no line %s in\n%s", line, dot)
+		}
+	}
+}
+
+func TestDependencyGraphTruncated(t *testing.T) {
+	cfg := &Config{Log: logger.DummyLogger{}, Zones: NewZoneCache(), Cache: NewServerCache()}
+	cfg.Zones.Set(".", testZone(".", "a.root-servers.net. 198.41.0.4"))
+	cfg.Zones.Set("test.", testZone("test.", "ns.test. 192.0.2.1"))
+
+	// z0 is served by a server in z1, z1 by one in z2, and so on
+	for i := range 2 * maxDependencyZones {
+		name := fmt.Sprintf("z%d.test.", i)
+		next := fmt.Sprintf("ns.z%d.test.", i+1)
+		cfg.Zones.Set(name, testZone(name, next+" 192.0.2.2"))
+		cfg.Zones.Set(next, testHost(next, fmt.Sprintf("z%d.test.", i+1)))
+	}
+
+	g := cfg.dependencyGraph("z0.test.", cfg.collect("z0.test.", false))
+	if !g.Truncated || g.Zones != maxDependencyZones {
+		t.Errorf("truncated %v at %d zones, want true at %d", g.Truncated, g.Zones, maxDependencyZones)
+	}
+}
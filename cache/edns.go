@@ -0,0 +1,279 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"zonetree/dig"
+)
+
+// EDNS compliance tests, after the ISC EDNS compliance tester (ednscomp).
+// All but the UDP size tests query for the SOA of the zone.
+const (
+	EdnsPlain   = "dns"       // No EDNS at all
+	EdnsZero    = "edns"      // EDNS version 0
+	EdnsOne     = "edns1"     // EDNS version 1, expects BADVERS
+	EdnsUnkOpt  = "ednsopt"   // Unknown option, must be ignored
+	EdnsUnkFlag = "ednsflags" // Unknown flag, must be ignored and not echoed
+	EdnsDO      = "do"        // DO bit, must be echoed
+	EdnsSmall   = "udp512"    // DNSKEY at 512 bytes, must fit or be truncated
+	EdnsLarge   = "udp4096"   // DNSKEY at 4096 bytes
+)
+
+// EDNS test results
+const (
+	EdnsOK      = "ok"
+	EdnsFail    = "fail"
+	EdnsTimeout = "timeout"
+)
+
+// EDNS compliance classes of a server
+const (
+	EdnsCompliant    = "compliant"    // All tests ok
+	EdnsNonCompliant = "noncompliant" // Answers everything, but not always right
+	EdnsDropping     = "dropping"     // Some EDNS queries get no response
+	EdnsBroken       = "broken"       // Plain DNS works, EDNS does not
+	EdnsUnreachable  = "unreachable"  // Not even plain DNS works
+)
+
+// Option code and flag that are not (yet) assigned, as used by ednscomp
+const (
+	ednsUnknownOpt  = 100
+	ednsUnknownFlag = 0x80
+)
+
+// EdnsTest
+//
+// Outcome of one test. Detail says what was wrong.
+type EdnsTest struct {
+	Test   string `json:"Test"`
+	Result string `json:"Result"`
+	Detail string `json:"Detail,omitempty"`
+}
+
+// EdnsResult
+//
+// All EDNS tests of one server, and the resulting class.
+type EdnsResult struct {
+	Name       string     `json:"Name"`
+	IP         string     `json:"IP"`
+	Compliance string     `json:"Compliance"`
+	Tests      []EdnsTest `json:"Tests"`
+}
+
+// ednsTest
+//
+// How to change the query for a test, and how to check the response.
+type ednsTest struct {
+	name  string
+	query func(q *dig.Query)
+	check func(zone string, msg *dns.Msg) string
+}
+
+var ednsTests = []ednsTest{
+	{EdnsPlain, func(q *dig.Query) { q.NoEdns = true }, func(zone string, msg *dns.Msg) string {
+		if d := checkSOA(zone, msg); d != "" {
+			return d
+		}
+		if msg.IsEdns0() != nil {
+			return "OPT in response to query without EDNS"
+		}
+		return ""
+	}},
+	{EdnsZero, func(q *dig.Query) {}, func(zone string, msg *dns.Msg) string {
+		if d := checkSOA(zone, msg); d != "" {
+			return d
+		}
+		return checkOPT(msg)
+	}},
+	{EdnsOne, func(q *dig.Query) { q.EdnsVersion = 1 }, func(zone string, msg *dns.Msg) string {
+		if msg.Rcode != dns.RcodeBadVers {
+			return "expected BADVERS, got " + rcodeString(msg.Rcode)
+		}
+		if d := checkOPT(msg); d != "" {
+			return d
+		}
+		if len(msg.Answer) > 0 {
+			return "answer with BADVERS"
+		}
+		return ""
+	}},
+	{EdnsUnkOpt, func(q *dig.Query) { q.EdnsOpt = fmt.Sprint(ednsUnknownOpt) }, func(zone string, msg *dns.Msg) string {
+		if d := checkSOA(zone, msg); d != "" {
+			return d
+		}
+		if d := checkOPT(msg); d != "" {
+			return d
+		}
+		if slices.ContainsFunc(msg.IsEdns0().Option, func(o dns.EDNS0) bool { return o.Option() == ednsUnknownOpt }) {
+			return "unknown option echoed"
+		}
+		return ""
+	}},
+	{EdnsUnkFlag, func(q *dig.Query) { q.EdnsFlags = ednsUnknownFlag }, func(zone string, msg *dns.Msg) string {
+		if d := checkSOA(zone, msg); d != "" {
+			return d
+		}
+		if d := checkOPT(msg); d != "" {
+			return d
+		}
+		if msg.IsEdns0().Z() != 0 {
+			return "unknown flag echoed"
+		}
+		return ""
+	}},
+	{EdnsDO, func(q *dig.Query) { q.DO = true }, func(zone string, msg *dns.Msg) string {
+		if d := checkSOA(zone, msg); d != "" {
+			return d
+		}
+		if d := checkOPT(msg); d != "" {
+			return d
+		}
+		if !msg.IsEdns0().Do() {
+			return "DO not echoed"
+		}
+		return ""
+	}},
+	{EdnsSmall, func(q *dig.Query) { q.Qtype = "DNSKEY"; q.UDPsize = 512; q.FixedUDPsize = true }, func(zone string, msg *dns.Msg) string {
+		if msg.Rcode != dns.RcodeSuccess {
+			return "expected NOERROR, got " + rcodeString(msg.Rcode)
+		}
+		if n := msg.Len(); n > 512 && !msg.Truncated {
+			return fmt.Sprintf("%d byte response without TC", n)
+		}
+		return ""
+	}},
+	{EdnsLarge, func(q *dig.Query) { q.Qtype = "DNSKEY"; q.UDPsize = 4096; q.FixedUDPsize = true }, func(zone string, msg *dns.Msg) string {
+		if msg.Rcode != dns.RcodeSuccess {
+			return "expected NOERROR, got " + rcodeString(msg.Rcode)
+		}
+		return checkOPT(msg)
+	}},
+}
+
+func rcodeString(rcode int) string {
+	if s, ok := dns.RcodeToString[rcode]; ok {
+		return s
+	}
+	return fmt.Sprint(rcode)
+}
+
+// errResult
+//
+// Tell a server not responding from a response that could not be read.
+func errResult(err error) string {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return EdnsTimeout
+	}
+	return EdnsFail
+}
+
+// checkSOA
+//
+// Check for an authoritative NOERROR with the SOA of zone.
+func checkSOA(zone string, msg *dns.Msg) string {
+	if msg.Rcode != dns.RcodeSuccess {
+		return "expected NOERROR, got " + rcodeString(msg.Rcode)
+	}
+	if !msg.Authoritative {
+		return "not authoritative"
+	}
+	if !slices.ContainsFunc(msg.Answer, func(rr dns.RR) bool {
+		return rr.Header().Rrtype == dns.TypeSOA && strings.EqualFold(rr.Header().Name, zone)
+	}) {
+		return "no SOA in answer"
+	}
+	return ""
+}
+
+// checkOPT
+//
+// Check for an OPT record of version 0.
+func checkOPT(msg *dns.Msg) string {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return "no OPT in response"
+	}
+	if v := opt.Version(); v != 0 {
+		return fmt.Sprintf("EDNS version %d in response", v)
+	}
+	return ""
+}
+
+// ProbeEDNS
+//
+// Run the EDNS compliance tests against each server of the zone, and
+// store the results on the zone. Servers that failed (500) are tested
+// too, broken EDNS is a common reason for that.
+func (z *Zone) ProbeEDNS(cfg *Config) {
+	z.EDNS = nil
+	var seen []string
+	for _, ns := range z.NSIP {
+		if !cfg.probeable(ns) || slices.Contains(seen, ns.IP) {
+			continue
+		}
+		seen = append(seen, ns.IP)
+		z.EDNS = append(z.EDNS, cfg.EDNS(ns.Name, ns.IP, z.Name))
+	}
+}
+
+// EDNS
+//
+// Run the EDNS compliance tests against the server at ip.
+func (c *Config) EDNS(name, ip, zone string) EdnsResult {
+	r := EdnsResult{Name: name, IP: ip}
+
+	for _, t := range ednsTests {
+		q := c.NewQuery()
+		q.Nameserver = ip
+		q.Qname = zone
+		q.Qtype = "SOA"
+		t.query(&q)
+
+		res := EdnsTest{Test: t.name, Result: EdnsOK}
+		out, err := probe(q)
+		switch {
+		case err != nil:
+			res.Result = errResult(err)
+			res.Detail = err.Error()
+		default:
+			if res.Detail = t.check(zone, out.Response); res.Detail != "" {
+				res.Result = EdnsFail
+			}
+		}
+		r.Tests = append(r.Tests, res)
+	}
+	r.Compliance = r.classify()
+
+	c.Log.Debug("EDNS compliance", "Server", name, "IP", ip, "Compliance", r.Compliance)
+
+	return r
+}
+
+// classify
+//
+// Get the compliance class from the test results.
+func (r EdnsResult) classify() string {
+	result := func(test string) string {
+		if i := slices.IndexFunc(r.Tests, func(t EdnsTest) bool { return t.Test == test }); i >= 0 {
+			return r.Tests[i].Result
+		}
+		return ""
+	}
+	switch {
+	case result(EdnsPlain) == EdnsTimeout:
+		return EdnsUnreachable
+	case result(EdnsPlain) == EdnsOK && result(EdnsZero) != EdnsOK:
+		return EdnsBroken
+	case slices.ContainsFunc(r.Tests, func(t EdnsTest) bool { return t.Result == EdnsTimeout }):
+		return EdnsDropping
+	case slices.ContainsFunc(r.Tests, func(t EdnsTest) bool { return t.Result == EdnsFail }):
+		return EdnsNonCompliant
+	}
+	return EdnsCompliant
+}
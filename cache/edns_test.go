@@ -0,0 +1,39 @@
+package cache
+
+import "testing"
+
+func TestEdnsClassify(t *testing.T) {
+	// results gives the result of each test, in the order of ednsTests
+	run := func(results ...string) EdnsResult {
+		var r EdnsResult
+		for i, res := range results {
+			r.Tests = append(r.Tests, EdnsTest{Test: ednsTests[i].name, Result: res})
+		}
+		return r
+	}
+	ok, fail, timeout := EdnsOK, EdnsFail, EdnsTimeout
+
+	tests := []struct {
+		name string
+		r    EdnsResult
+		want string
+	}{
+		{"all ok", run(ok, ok, ok, ok, ok, ok, ok, ok), EdnsCompliant},
+		{"no tests", EdnsResult{}, EdnsCompliant},
+		{"no answer at all", run(timeout, timeout, timeout, timeout, timeout, timeout, timeout, timeout), EdnsUnreachable},
+		{"plain dns only", run(ok, timeout, timeout, timeout, timeout, timeout, timeout, timeout), EdnsBroken},
+		{"edns formerr", run(ok, fail, fail, fail, fail, fail, fail, fail), EdnsBroken},
+		{"drops edns1", run(ok, ok, timeout, ok, ok, ok, ok, ok), EdnsDropping},
+		{"drops large", run(ok, ok, ok, ok, ok, ok, ok, timeout), EdnsDropping},
+		{"no badvers", run(ok, ok, fail, ok, ok, ok, ok, ok), EdnsNonCompliant},
+		{"timeout over fail", run(ok, ok, fail, timeout, ok, ok, ok, ok), EdnsDropping},
+		{"plain dns fails", run(fail, ok, ok, ok, ok, ok, ok, ok), EdnsNonCompliant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.classify(); got != tt.want {
+				t.Errorf("classify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TTL used in exported zone files for records without a known TTL,
+// e.g. from imported zone files or older caches.
+const exportTTL = 86400
+
+// rrGroup
+//
+// A set of records, and the servers that returned exactly that set.
+type rrGroup struct {
+	records []string
+	servers []string
+}
+
+// addGroup
+//
+// Add records seen at server to the list of groups, merging with an
+// existing group if the records are the same.
+func addGroup(groups []rrGroup, records []string, server string) []rrGroup {
+	for i, g := range groups {
+		if slices.Equal(g.records, records) {
+			groups[i].servers = append(groups[i].servers, server)
+			return groups
+		}
+	}
+	return append(groups, rrGroup{records: records, servers: []string{server}})
+}
+
+// ToZoneFile
+//
+// Render the zone as RFC 1035 master file text. The parent side
+// (NS, in-bailiwick glue and DS, as published by the parent nameservers) and the
+// child side (SOA, NS and DNSKEY, as served by the zone's own nameservers)
+// are written as separate sections. Identical data from several servers
+// is written once, with a comment listing where it came from.
+// Differences between servers, and between parent and child, are noted
+// as comments at the end. Records are written with the TTL they were
+// received with, if known.
+func (z Zone) ToZoneFile() string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "; Zone: %s\n; Status: %d (%s)\n", z.Name, z.Status, ZoneStatus[z.Status])
+	if z.Alias != "" {
+		fmt.Fprintf(&b, "; Alias: %s %s\n", z.AliasRR, z.Alias)
+	}
+	for _, cycle := range z.Cycles {
+		fmt.Fprintf(&b, "; NS dependency cycle: %s\n", CycleString(cycle))
+	}
+	if !z.Expires.IsZero() {
+		fmt.Fprintf(&b, "; Expires: %s\n", z.Expires.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "$TTL %d ; for records without a known TTL\n", exportTTL)
+
+	// Parent side
+	var parent []rrGroup
+	parentNS := make(map[string][]string) // server -> NS names
+	for _, p := range z.ParentNS {
+		if p.ChildStatus != 200 {
+			continue
+		}
+		var rrs []string
+		names := z.nsNames(p.NS)
+		for _, name := range names {
+			rrs = append(rrs, rrLine(z.Name, p.TTL, "NS", name))
+		}
+		// Only glue the parent sent, for in-bailiwick names of the NS set
+		for _, g := range p.Glue {
+			name, ip, _ := strings.Cut(g, " ")
+			if slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) }) && DelegationInBailiwick(name, z.Name) {
+				rrs = append(rrs, rrLine(name, p.TTL, addrType(ip), ip))
+			}
+		}
+		for _, ds := range p.DS {
+			rrs = append(rrs, rrLine(z.Name, p.TTL, "DS", ds))
+		}
+		for _, sig := range p.RRSIG {
+			rrs = append(rrs, rrLine(z.Name, p.TTL, "RRSIG", sig))
+		}
+		slices.Sort(rrs)
+		rrs = slices.Compact(rrs)
+		server := serverLabel(p.Name, p.IP)
+		parentNS[server] = names
+		parent = addGroup(parent, rrs, server)
+	}
+
+	b.WriteString(";\n; ---- Parent side (delegation) ----\n")
+	writeGroups(&b, parent)
+
+	// Child side
+	var child []rrGroup
+	childNS := make(map[string][]string) // server -> NS names
+	for _, zns := range z.ZoneNS {
+		// Made up from the parent, see ImportZoneFile
+		if zns.Source != "" {
+			continue
+		}
+		var rrs []string
+		if zns.SOA != "" {
+			rrs = append(rrs, rrLine(z.Name, zns.TTL, "SOA", zns.SOA))
+		}
+		names := z.nsNames(zns.NS)
+		for _, name := range names {
+			rrs = append(rrs, rrLine(z.Name, zns.TTL, "NS", name))
+		}
+		for _, key := range zns.DNSKEY {
+			rrs = append(rrs, rrLine(z.Name, zns.TTL, "DNSKEY", key))
+		}
+		for _, sig := range zns.RRSIG {
+			rrs = append(rrs, rrLine(z.Name, zns.TTL, "RRSIG", sig))
+		}
+		slices.Sort(rrs)
+		self := z.nsip(zns.Self)
+		server := serverLabel(self.Name, self.IP)
+		childNS[server] = names
+		child = addGroup(child, rrs, server)
+	}
+
+	b.WriteString(";\n; ---- Child side (apex) ----\n")
+	writeGroups(&b, child)
+
+	// Differences
+	var diff []string
+	if len(parent) > 1 {
+		diff = append(diff, fmt.Sprintf("Parent servers disagree (%d different delegations)", len(parent)))
+	}
+	if len(child) > 1 {
+		diff = append(diff, fmt.Sprintf("Child servers disagree (%d different apex data sets)", len(child)))
+	}
+	psets, csets := nsSets(parentNS), nsSets(childNS)
+	for _, pset := range slices.Sorted(maps.Keys(psets)) {
+		for _, cset := range slices.Sorted(maps.Keys(csets)) {
+			if pset == cset {
+				continue
+			}
+			pnames, cnames := strings.Fields(pset), strings.Fields(cset)
+			diff = append(diff, fmt.Sprintf("NS differ between parent %s and child %s. Parent only: [%s] Child only: [%s]",
+				strings.Join(psets[pset], ", "), strings.Join(csets[cset], ", "),
+				strings.Join(without(pnames, cnames), " "), strings.Join(without(cnames, pnames), " ")))
+		}
+	}
+
+	for _, g := range z.Glue {
+		what := strings.Join(strings.Fields(g.NS+" "+g.IP+" "+g.Detail), " ")
+		diff = append(diff, fmt.Sprintf("Glue %s: %s (%s)", g.Issue, what, strings.Join(g.Servers, ", ")))
+	}
+
+	if len(diff) > 0 {
+		b.WriteString(";\n; ---- Differences ----\n")
+		for _, d := range diff {
+			b.WriteString("; " + d + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// nsNames
+//
+// Get the sorted, unique NS names referenced by a list of NSIP indexes.
+func (z *Zone) nsNames(ids []int8) []string {
+	var names []string
+	for _, id := range ids {
+		names = append(names, z.nsip(id).Name)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// nsip
+//
+// Get an NSIP entry by index, without panicking on bad references.
+func (z *Zone) nsip(id int8) NSIP {
+	if id < 0 || int(id) >= len(z.NSIP) {
+		return NSIP{}
+	}
+	return z.NSIP[id]
+}
+
+// nsSets
+//
+// Turn a map[server]nsnames into map[nsnames]servers
+func nsSets(m map[string][]string) map[string][]string {
+	sets := make(map[string][]string)
+	for _, server := range slices.Sorted(maps.Keys(m)) {
+		names := m[server]
+		key := strings.Join(names, " ")
+		sets[key] = append(sets[key], server)
+	}
+	return sets
+}
+
+// without
+//
+// Get the entries of a not found in b
+func without(a, b []string) []string {
+	var r []string
+	for _, s := range a {
+		if !slices.Contains(b, s) {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+// rrLine
+//
+// Format one record. The TTL is taken from ttls, and left out (see
+// $TTL) if not known for rtype.
+func rrLine(owner string, ttls map[string]uint32, rtype, rdata string) string {
+	if ttl, ok := ttls[rtype]; ok {
+		return fmt.Sprintf("%-30s %-7d IN %-6s %s", owner, ttl, rtype, rdata)
+	}
+	return fmt.Sprintf("%-30s IN %-6s %s", owner, rtype, rdata)
+}
+
+func addrType(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "AAAA"
+	}
+	return "A"
+}
+
+func serverLabel(name, ip string) string {
+	if ip == "" {
+		return name
+	}
+	return name + " (" + ip + ")"
+}
+
+func writeGroups(b *strings.Builder, groups []rrGroup) {
+	if len(groups) < 1 {
+		b.WriteString("; (no data)\n")
+	}
+	for _, g := range groups {
+		b.WriteString(";\n; from " + strings.Join(g.servers, ", ") + "\n")
+		for _, rr := range g.records {
+			b.WriteString(rr + "\n")
+		}
+	}
+}
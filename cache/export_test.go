@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestToZoneFile(t *testing.T) {
+	z := Zone{Name: "example.se.", ZoneCut: "example.se.", Status: 200,
+		NSIP: []NSIP{
+			{Name: "ns1.example.se.", IP: "192.0.2.1"},
+			{Name: "ns.other.net.", IP: "198.51.100.1"},
+		},
+		ParentNS: []ParentNS{
+			{Name: "a.ns.se.", IP: "192.0.2.53", NS: []int8{0, 1}, ChildStatus: 200,
+				DS: []string{"12345 13 2 00ff"},
+				Glue: []string{
+					"ns1.example.se. 192.0.2.1",    // In bailiwick
+					"ns.other.net. 198.51.100.1",   // In the NS set, but not the parent's to give
+					"ns9.example.se. 192.0.2.9",    // Not in the NS set
+					"ns1.example.se. 2001:db8::53", // In bailiwick, v6
+				},
+				TTL: map[string]uint32{"NS": 172800, "A": 86400, "AAAA": 7200, "DS": 3600}},
+			// Imported from a zone file, nothing known about TTLs
+			{Name: "se.zone", NS: []int8{0}, ChildStatus: 200, Glue: []string{"ns1.example.se. 192.0.2.1"}},
+			// Not a delegation
+			{Name: "b.ns.se.", IP: "192.0.2.54", NS: []int8{0}, ChildStatus: 404},
+		},
+		ZoneNS: []ZoneNS{
+			{Self: 0, NS: []int8{0, 1}, SOA: "ns1.example.se. hostmaster.example.se. 1 3600 600 86400 300",
+				TTL: map[string]uint32{"SOA": 300, "NS": 3600}},
+			// Made up by an import, not from the server
+			{Self: 1, NS: []int8{1}, Source: "se.zone"},
+		},
+	}
+
+	out := z.ToZoneFile()
+
+	// owner TTL type RDATA, TTL "-" if not written
+	var records []string
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 3 || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "$") {
+			continue
+		}
+		if f[1] == "IN" {
+			f = slices.Insert(f, 1, "-")
+		}
+		records = append(records, strings.Join(slices.Delete(f, 2, 3), " "))
+	}
+
+	tests := []struct {
+		record string
+		want   bool
+	}{
+		{"example.se. 172800 NS ns1.example.se.", true},
+		{"example.se. 172800 NS ns.other.net.", true},
+		{"ns1.example.se. 86400 A 192.0.2.1", true},
+		{"ns1.example.se. 7200 AAAA 2001:db8::53", true},
+		{"example.se. 3600 DS 12345 13 2 00ff", true},
+		{"ns.other.net. 86400 A 198.51.100.1", false}, // Out of bailiwick
+		{"ns9.example.se. 86400 A 192.0.2.9", false},  // Not in the NS set
+		{"example.se. - NS ns1.example.se.", true},    // Imported, no TTL
+		{"ns1.example.se. - A 192.0.2.1", true},
+		{"example.se. 300 SOA ns1.example.se. hostmaster.example.se. 1 3600 600 86400 300", true},
+		{"example.se. 3600 NS ns1.example.se.", true},
+		{"example.se. - NS ns.other.net.", false}, // Made up ZoneNS
+	}
+	for _, tt := range tests {
+		t.Run(tt.record, func(t *testing.T) {
+			if got := slices.Contains(records, tt.record); got != tt.want {
+				t.Errorf("record written = %v, want %v\n%s", got, tt.want, out)
+			}
+		})
+	}
+
+	if strings.Contains(out, "b.ns.se.") {
+		t.Errorf("non-delegation written\n%s", out)
+	}
+}
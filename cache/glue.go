@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Glue issues
+const (
+	GlueMissing     = "missing"     // In-bailiwick NS without glue
+	GlueUnnecessary = "unnecessary" // Glue for a name the parent is not authoritative for
+	GlueMismatch    = "mismatch"    // Glue differs from the A/AAAA served by the child
+	GlueOrphan      = "orphan"      // Glue for a name not in the NS set
+	GlueBogon       = "bogon"       // Glue in a private, reserved or otherwise unroutable range
+)
+
+// Ranges that have no business being in glue, other than the ones
+// netip.Addr already knows about (private, loopback, link local, etc).
+var bogons = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("3fff::/20"),
+}
+
+// GlueIssue
+//
+// A problem with the glue of a delegation, and the parent servers
+// that have it.
+type GlueIssue struct {
+	Issue   string   `json:"Issue"` // See the Glue* constants
+	NS      string   `json:"NS"`
+	IP      string   `json:"IP,omitempty"`
+	Detail  string   `json:"Detail,omitempty"`
+	Servers []string `json:"Servers"`
+}
+
+func glueEntry(name, ip string) string {
+	return strings.ToLower(name) + " " + ip
+}
+
+// AnalyzeGlue
+//
+// Check the glue each parent server sent with the delegation of the
+// zone. parent is the name of the parent zone, i.e. what the parent
+// servers are authoritative for.
+func (z *Zone) AnalyzeGlue(parent string) []GlueIssue {
+
+	var issues []GlueIssue
+	add := func(issue, ns, ip, detail, server string) {
+		i := slices.IndexFunc(issues, func(g GlueIssue) bool {
+			return g.Issue == issue && g.NS == ns && g.IP == ip && g.Detail == detail
+		})
+		if i < 0 {
+			issues = append(issues, GlueIssue{Issue: issue, NS: ns, IP: ip, Detail: detail})
+			i = len(issues) - 1
+		}
+		if !slices.Contains(issues[i].Servers, server) {
+			issues[i].Servers = append(issues[i].Servers, server)
+		}
+	}
+
+	child := z.childAddrs()
+
+	for _, p := range z.ParentNS {
+		// Imported zone files have no parent IP, but do have glue
+		if p.ChildStatus != 200 {
+			continue
+		}
+		server := serverLabel(p.Name, p.IP)
+
+		glue := make(map[string][]string)
+		for _, g := range p.Glue {
+			name, ip, _ := strings.Cut(g, " ")
+			glue[name] = append(glue[name], ip)
+		}
+
+		names := z.nsNames(p.NS)
+		for i := range names {
+			names[i] = strings.ToLower(names[i])
+		}
+
+		for _, name := range names {
+			if DelegationInBailiwick(name, z.Name) && len(glue[name]) < 1 {
+				add(GlueMissing, name, "", "", server)
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(glue)) {
+			ips := glue[name]
+			slices.Sort(ips)
+			for _, ip := range ips {
+				if !slices.Contains(names, name) {
+					add(GlueOrphan, name, ip, "", server)
+				} else if parent != "" && !dns.IsSubDomain(parent, name) {
+					add(GlueUnnecessary, name, ip, "not in bailiwick of "+parent, server)
+				}
+				if reason := bogon(ip); reason != "" {
+					add(GlueBogon, name, ip, reason, server)
+				}
+			}
+
+			// Only in-zone names are served by the child itself
+			if addrs, ok := child[name]; ok && DelegationInBailiwick(name, z.Name) && !slices.Equal(ips, addrs) {
+				add(GlueMismatch, name, "", "parent ["+strings.Join(ips, " ")+"] child ["+strings.Join(addrs, " ")+"]", server)
+			}
+		}
+	}
+
+	return issues
+}
+
+// childAddrs
+//
+// Get the addresses of the NS names as seen from the zone's own servers.
+func (z *Zone) childAddrs() map[string][]string {
+	addrs := make(map[string][]string)
+	for _, zns := range z.ZoneNS {
+		// Made up from the parent, see ImportZoneFile
+		if zns.Source != "" {
+			continue
+		}
+		for _, id := range zns.NS {
+			ns := z.nsip(id)
+			name := strings.ToLower(ns.Name)
+			if ns.IP != "" && !slices.Contains(addrs[name], ns.IP) {
+				addrs[name] = append(addrs[name], ns.IP)
+			}
+		}
+	}
+	for name := range addrs {
+		slices.Sort(addrs[name])
+	}
+	return addrs
+}
+
+// bogon
+//
+// Get the reason ip should not be used for a nameserver. Empty if it's fine.
+func bogon(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "not an IP address"
+	}
+	addr = addr.Unmap()
+	switch {
+	case addr.IsUnspecified():
+		return "unspecified"
+	case addr.IsLoopback():
+		return "loopback"
+	case addr.IsPrivate():
+		return "private"
+	case addr.IsLinkLocalUnicast():
+		return "link local"
+	case addr.IsMulticast():
+		return "multicast"
+	}
+	for _, p := range bogons {
+		if p.Contains(addr) {
+			return "reserved (" + p.String() + ")"
+		}
+	}
+	return ""
+}
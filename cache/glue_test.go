@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// glueZone
+//
+// example.com. as delegated by one com. server with ns and glue ("name
+// ip"), with the addresses of child ("name ip") served by the zone itself.
+func glueZone(ns, glue, child []string) Zone {
+	z := Zone{Name: "example.com.", ZoneCut: "example.com.", Status: 200}
+	p := ParentNS{Name: "a.gtld-servers.net.", IP: "192.5.6.30", Glue: glue, ChildStatus: 200}
+	for _, name := range ns {
+		p.NS = append(p.NS, z.addNSIP(name, ""))
+	}
+	zns := ZoneNS{Self: -1}
+	for _, s := range child {
+		name, ip, _ := strings.Cut(s, " ")
+		zns.NS = append(zns.NS, z.addNSIP(name, ip))
+	}
+	z.ParentNS = []ParentNS{p}
+	z.ZoneNS = []ZoneNS{zns}
+	return z
+}
+
+func TestAnalyzeGlue(t *testing.T) {
+	const server = "a.gtld-servers.net. (192.5.6.30)"
+	ns := []string{"ns1.example.com.", "ns.provider.net."}
+	child := []string{"ns1.example.com. 93.184.216.34", "ns1.example.com. 2606:2800:220:1::34"}
+	glue := []string{"ns1.example.com. 93.184.216.34", "ns1.example.com. 2606:2800:220:1::34"}
+
+	tests := []struct {
+		name   string
+		ns     []string
+		glue   []string
+		child  []string
+		issues []string // Issue NS IP Detail
+	}{
+		{"fine", ns, glue, child, nil},
+		{"missing", append(ns, "ns2.example.com."), glue, child,
+			[]string{"missing ns2.example.com.  "}},
+		{"stray", ns, append(glue, "ns9.example.com. 93.184.216.35"), child,
+			[]string{"orphan ns9.example.com. 93.184.216.35 "}},
+		{"mismatched", ns, glue, []string{"ns1.example.com. 93.184.216.35"},
+			[]string{"mismatch ns1.example.com.  parent [2606:2800:220:1::34 93.184.216.34] child [93.184.216.35]"}},
+		{"bogon", ns, []string{"ns1.example.com. 10.0.0.1"}, []string{"ns1.example.com. 10.0.0.1"},
+			[]string{"bogon ns1.example.com. 10.0.0.1 private"}},
+		{"unnecessary", ns, append(glue, "ns.provider.net. 93.184.216.36"), child,
+			[]string{"unnecessary ns.provider.net. 93.184.216.36 not in bailiwick of com."}},
+		// Only in-zone names are served by the child
+		{"out of zone not compared", ns, glue, append(child, "ns.provider.net. 93.184.216.37"), nil},
+		{"case insensitive", []string{"NS1.Example.COM.", "ns.provider.net."}, glue, child, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := glueZone(tt.ns, tt.glue, tt.child)
+			var issues []string
+			for _, g := range z.AnalyzeGlue("com.") {
+				if !slices.Equal(g.Servers, []string{server}) {
+					t.Errorf("%s %s: Servers = %q, want %q", g.Issue, g.NS, g.Servers, server)
+				}
+				issues = append(issues, g.Issue+" "+g.NS+" "+g.IP+" "+g.Detail)
+			}
+			if !slices.Equal(issues, tt.issues) {
+				t.Errorf("issues = %q, want %q", issues, tt.issues)
+			}
+		})
+	}
+
+	// Glue from a parent that did not delegate is not checked
+	z := glueZone(ns, []string{"ns1.example.com. 10.0.0.1"}, child)
+	z.ParentNS[0].ChildStatus = 204
+	if issues := z.AnalyzeGlue("com."); issues != nil {
+		t.Errorf("issues = %+v, want none", issues)
+	}
+}
+
+func TestBogon(t *testing.T) {
+	tests := []struct {
+		ip     string
+		reason string
+	}{
+		{"93.184.216.34", ""},
+		{"2606:2800:220:1::34", ""},
+		{"0.0.0.0", "unspecified"},
+		{"127.0.0.1", "loopback"},
+		{"::ffff:192.168.1.1", "private"},
+		{"fd00::1", "private"},
+		{"fe80::1", "link local"},
+		{"224.0.0.1", "multicast"},
+		{"100.64.1.1", "reserved (100.64.0.0/10)"},
+		{"2001:db8::53", "reserved (2001:db8::/32)"},
+		{"ns1.example.com.", "not an IP address"},
+	}
+	for _, tt := range tests {
+		if got := bogon(tt.ip); got != tt.reason {
+			t.Errorf("bogon(%s) = %q, want %q", tt.ip, got, tt.reason)
+		}
+	}
+}
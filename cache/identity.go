@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"zonetree/dig"
+)
+
+// Identity
+//
+// What an authoritative server says about itself, from NSID and the
+// CHAOS TXT queries. Servers may not answer, or answer anything, so
+// this is a hint, not proof.
+type Identity struct {
+	NSID     string `json:"NSID,omitempty"`
+	Hostname string `json:"Hostname,omitempty"` // hostname.bind
+	ID       string `json:"ID,omitempty"`       // id.server
+	Version  string `json:"Version,omitempty"`  // version.bind
+}
+
+// Instance
+//
+// Get the best name for the box that answered. NSID, then id.server,
+// then hostname.bind. Empty if the server didn't tell.
+func (id Identity) Instance() string {
+	switch {
+	case id.NSID != "":
+		return id.NSID
+	case id.ID != "":
+		return id.ID
+	}
+	return id.Hostname
+}
+
+// Instances
+//
+// Servers of a zone grouped by identity. Servers are labeled
+// name (IP), see serverLabel.
+// Instance	- Instance name -> servers answering as that instance.
+// Software	- version.bind -> servers.
+// Unknown	- Servers that didn't identify themselves.
+// Shared	- Instances answering on more than one address.
+type Instances struct {
+	Instance map[string][]string `json:"Instance"`
+	Software map[string][]string `json:"Software"`
+	Unknown  []string            `json:"Unknown"`
+	Shared   []string            `json:"Shared"`
+}
+
+// ProbeIdentity
+//
+// Ask each authoritative server of the zone who it is, record the
+// answers on the NSIP entries and group the servers.
+func (z *Zone) ProbeIdentity(cfg *Config) {
+	probed := make(map[string]*Identity)
+	for i, ns := range z.NSIP {
+		if !cfg.probeable(ns) || (ns.ZoneStatus != 200 && ns.ZoneStatus != 0) {
+			continue
+		}
+		id, ok := probed[ns.IP]
+		if !ok {
+			p := cfg.Identity(ns.Name, ns.IP, z.Name)
+			id = &p
+			probed[ns.IP] = id
+		}
+		z.NSIP[i].Identity = id
+	}
+	in := z.GroupInstances()
+	z.Instances = &in
+}
+
+// probeable
+//
+// Check if ns has an address, of a family the options allow.
+func (c *Config) probeable(ns NSIP) bool {
+	if ns.IP == "" {
+		return false
+	}
+	v6 := strings.Contains(ns.IP, ":")
+	return !(c.Opt.IPv4only && v6) && !(c.Opt.IPv6only && !v6)
+}
+
+// Identity
+//
+// Ask the server at ip for NSID (in a SOA query for zone) and for
+// hostname.bind, id.server and version.bind in class CHAOS.
+func (c *Config) Identity(name, ip, zone string) Identity {
+	var id Identity
+
+	q := c.NewQuery()
+	q.Nameserver = ip
+	q.Qname = zone
+	q.Qtype = "SOA"
+	q.Nsid = true
+	if out, err := probe(q); err == nil {
+		id.NSID = dig.NSID(out.Response)
+	}
+
+	q.Nsid = false
+	q.Qtype = "TXT"
+	q.Qclass = "CH"
+	for _, t := range []struct {
+		qname string
+		field *string
+	}{
+		{"hostname.bind.", &id.Hostname},
+		{"id.server.", &id.ID},
+		{"version.bind.", &id.Version},
+	} {
+		q.Qname = t.qname
+		out, err := probe(q)
+		if err != nil || out.Response.Rcode != dns.RcodeSuccess {
+			continue
+		}
+		*t.field = chaosTXT(t.qname, out.Response)
+	}
+
+	c.Log.Debug("Server identity", "Server", name, "IP", ip, "Identity", id)
+
+	return id
+}
+
+// chaosTXT
+//
+// Get the TXT for qname from the answer section of msg.
+func chaosTXT(qname string, msg *dns.Msg) string {
+	for _, rr := range msg.Answer {
+		if t, ok := rr.(*dns.TXT); ok && strings.EqualFold(t.Hdr.Name, qname) {
+			return strings.Join(t.Txt, " ")
+		}
+	}
+	return ""
+}
+
+// GroupInstances
+//
+// Group the probed servers of the zone by instance and software.
+// Addresses answering as the same instance are most likely the same box,
+// e.g. the IPv4 and IPv6 address of one server, or two "different"
+// servers that aren't.
+func (z *Zone) GroupInstances() Instances {
+	in := Instances{Instance: make(map[string][]string), Software: make(map[string][]string)}
+	addrs := make(map[string][]string)
+
+	for _, ns := range z.NSIP {
+		if ns.Identity == nil {
+			continue
+		}
+		label := serverLabel(strings.ToLower(ns.Name), ns.IP)
+		if v := ns.Identity.Version; v != "" && !slices.Contains(in.Software[v], label) {
+			in.Software[v] = append(in.Software[v], label)
+		}
+		inst := ns.Identity.Instance()
+		if inst == "" {
+			if !slices.Contains(in.Unknown, label) {
+				in.Unknown = append(in.Unknown, label)
+			}
+			continue
+		}
+		if !slices.Contains(in.Instance[inst], label) {
+			in.Instance[inst] = append(in.Instance[inst], label)
+		}
+		if !slices.Contains(addrs[inst], ns.IP) {
+			addrs[inst] = append(addrs[inst], ns.IP)
+		}
+	}
+
+	for _, inst := range slices.Sorted(maps.Keys(addrs)) {
+		ips := addrs[inst]
+		if len(ips) > 1 {
+			in.Shared = append(in.Shared, fmt.Sprintf("%s (%d addresses)", inst, len(ips)))
+		}
+	}
+	for k := range in.Instance {
+		slices.Sort(in.Instance[k])
+	}
+	for k := range in.Software {
+		slices.Sort(in.Software[k])
+	}
+	slices.Sort(in.Unknown)
+
+	return in
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// IndexedZones
+//
+// Zone Map that keeps reverse indexes up to date on every write:
+// nameserver name -> zones, and IP -> nameserver names -> zones.
+// Used for impact analysis, i.e. what breaks if this server goes down.
+// Writes hold mu across the map write and the index update, so the
+// index always matches what is stored, also with concurrent writers.
+type IndexedZones struct {
+	Map[Zone]
+	mu      sync.RWMutex
+	nsZones map[string]map[string]bool // NS name -> zones
+	ipNames map[string]map[string]int  // IP -> NS names -> number of zones with that pair
+	entries map[string][]NSIP          // zone -> what was indexed, for removal
+}
+
+// NewIndexedZones creates an IndexedZones on top of base. Anything
+// already in base is indexed.
+func NewIndexedZones(base Map[Zone]) *IndexedZones {
+	ix := &IndexedZones{Map: base}
+	ix.reset()
+	for t := range base.IterBuffered() {
+		ix.index(t.Key, t.Value)
+	}
+	return ix
+}
+
+func (ix *IndexedZones) reset() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.resetLocked()
+}
+
+func (ix *IndexedZones) resetLocked() {
+	ix.nsZones = make(map[string]map[string]bool)
+	ix.ipNames = make(map[string]map[string]int)
+	ix.entries = make(map[string][]NSIP)
+}
+
+func (ix *IndexedZones) Set(key string, value Zone) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.Map.Set(key, value)
+	ix.indexLocked(key, value)
+}
+
+func (ix *IndexedZones) Remove(key string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.Map.Remove(key)
+	ix.unindexLocked(key)
+}
+
+func (ix *IndexedZones) Clear() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.Map.Clear()
+	ix.resetLocked()
+}
+
+func (ix *IndexedZones) Pop(key string) (Zone, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	v, ok := ix.Map.Pop(key)
+	ix.unindexLocked(key)
+	return v, ok
+}
+
+// Upsert
+//
+// The callback runs with the index locked, so it must not use ix.
+func (ix *IndexedZones) Upsert(key string, value Zone, cb UpsertFunc[Zone]) (Zone, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	res, err := ix.Map.Upsert(key, value, cb)
+	if err != nil {
+		return res, err
+	}
+	ix.indexLocked(key, res)
+	return res, nil
+}
+
+// index
+//
+// Replace the index entries of zone key with the NSIP list of z.
+func (ix *IndexedZones) index(key string, z Zone) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.indexLocked(key, z)
+}
+
+func (ix *IndexedZones) indexLocked(key string, z Zone) {
+	ix.unindexLocked(key)
+
+	var entries []NSIP
+	for _, ns := range z.NSIP {
+		e := NSIP{Name: strings.ToLower(ns.Name), IP: ns.IP}
+		if e.Name == "" || slices.ContainsFunc(entries, func(n NSIP) bool { return n.Name == e.Name && n.IP == e.IP }) {
+			continue
+		}
+		entries = append(entries, e)
+
+		if ix.nsZones[e.Name] == nil {
+			ix.nsZones[e.Name] = make(map[string]bool)
+		}
+		ix.nsZones[e.Name][key] = true
+
+		if e.IP == "" {
+			continue
+		}
+		if ix.ipNames[e.IP] == nil {
+			ix.ipNames[e.IP] = make(map[string]int)
+		}
+		ix.ipNames[e.IP][e.Name]++
+	}
+	ix.entries[key] = entries
+}
+
+func (ix *IndexedZones) unindexLocked(key string) {
+	for _, e := range ix.entries[key] {
+		delete(ix.nsZones[e.Name], key)
+		if len(ix.nsZones[e.Name]) < 1 {
+			delete(ix.nsZones, e.Name)
+		}
+		if e.IP == "" {
+			continue
+		}
+		ix.ipNames[e.IP][e.Name]--
+		if ix.ipNames[e.IP][e.Name] < 1 {
+			delete(ix.ipNames[e.IP], e.Name)
+		}
+		if len(ix.ipNames[e.IP]) < 1 {
+			delete(ix.ipNames, e.IP)
+		}
+	}
+	delete(ix.entries, key)
+}
+
+// ZonesByNS
+//
+// Get the zones served (or delegated to) by the nameserver name.
+func (ix *IndexedZones) ZonesByNS(name string) []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return slices.Sorted(maps.Keys(ix.nsZones[ToFQDN(strings.ToLower(name))]))
+}
+
+// ZonesByIP
+//
+// Get the nameserver names using ip, and the zones of each name.
+func (ix *IndexedZones) ZonesByIP(ip string) map[string][]string {
+	ix.mu.RLock()
+	names := slices.Sorted(maps.Keys(ix.ipNames[ip]))
+	ix.mu.RUnlock()
+
+	r := make(map[string][]string)
+	for _, name := range names {
+		r[name] = ix.ZonesByNS(name)
+	}
+	return r
+}
+
+// SharedInfra
+//
+// Nameserver names and IPs used by both of two zones.
+type SharedInfra struct {
+	Zones []string `json:"Zones"`
+	NS    []string `json:"NS"`
+	IP    []string `json:"IP"`
+}
+
+// Shared
+//
+// Get the nameserver names and IPs zones a and b have in common.
+func (ix *IndexedZones) Shared(a, b string) SharedInfra {
+	a, b = ToFQDN(strings.ToLower(a)), ToFQDN(strings.ToLower(b))
+	s := SharedInfra{Zones: []string{a, b}}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	for _, ea := range ix.entries[a] {
+		for _, eb := range ix.entries[b] {
+			if ea.Name == eb.Name && !slices.Contains(s.NS, ea.Name) {
+				s.NS = append(s.NS, ea.Name)
+			}
+			if ea.IP != "" && ea.IP == eb.IP && !slices.Contains(s.IP, ea.IP) {
+				s.IP = append(s.IP, ea.IP)
+			}
+		}
+	}
+	slices.Sort(s.NS)
+	slices.Sort(s.IP)
+
+	return s
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// failingMap is a Map[Zone] whose Upsert always fails
+type failingMap struct {
+	Map[Zone]
+}
+
+func (failingMap) Upsert(key string, value Zone, cb UpsertFunc[Zone]) (Zone, error) {
+	return Zone{}, errors.New("no upsert")
+}
+
+// checkIndex
+//
+// Check the zones of each NS name, and the names and zones of each IP.
+// Names and IPs not listed must not be in the index at all.
+func checkIndex(t *testing.T, ix *IndexedZones, byNS map[string][]string, byIP map[string]map[string][]string) {
+	t.Helper()
+	for _, name := range []string{"ns1.example.net.", "ns2.example.net.", "ns.example.org."} {
+		if got := ix.ZonesByNS(name); !slices.Equal(got, byNS[name]) {
+			t.Errorf("ZonesByNS(%s) = %q, want %q", name, got, byNS[name])
+		}
+	}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		got := ix.ZonesByIP(ip)
+		if !maps.EqualFunc(got, byIP[ip], slices.Equal) || len(got) != len(byIP[ip]) {
+			t.Errorf("ZonesByIP(%s) = %q, want %q", ip, got, byIP[ip])
+		}
+	}
+	if len(ix.nsZones) != len(byNS) || len(ix.ipNames) != len(byIP) {
+		t.Errorf("index has %d names and %d IPs, want %d and %d", len(ix.nsZones), len(ix.ipNames), len(byNS), len(byIP))
+	}
+}
+
+func TestIndexedZones(t *testing.T) {
+	base := NewZoneCache()
+	base.Set("example.com.", testZone("example.com.", "ns1.example.net. 192.0.2.1", "NS2.Example.NET. 192.0.2.2"))
+
+	ix := NewIndexedZones(base)
+	ix.Set("example.org.", testZone("example.org.", "ns1.example.net. 192.0.2.1", "ns.example.org. 192.0.2.3", "ns.example.org."))
+
+	t.Run("indexed", func(t *testing.T) {
+		checkIndex(t, ix, map[string][]string{
+			"ns1.example.net.": {"example.com.", "example.org."},
+			"ns2.example.net.": {"example.com."},
+			"ns.example.org.":  {"example.org."},
+		}, map[string]map[string][]string{
+			"192.0.2.1": {"ns1.example.net.": {"example.com.", "example.org."}},
+			"192.0.2.2": {"ns2.example.net.": {"example.com."}},
+			"192.0.2.3": {"ns.example.org.": {"example.org."}},
+		})
+	})
+
+	t.Run("Shared", func(t *testing.T) {
+		s := ix.Shared("Example.COM", "example.org.")
+		if !slices.Equal(s.Zones, []string{"example.com.", "example.org."}) ||
+			!slices.Equal(s.NS, []string{"ns1.example.net."}) || !slices.Equal(s.IP, []string{"192.0.2.1"}) {
+			t.Errorf("Shared = %+v", s)
+		}
+		if s := ix.Shared("example.com.", "example.net."); s.NS != nil || s.IP != nil {
+			t.Errorf("Shared with a zone not in cache = %+v", s)
+		}
+	})
+
+	t.Run("Set replaces", func(t *testing.T) {
+		// ns2.example.net. moves to 192.0.2.3, ns1.example.net. is gone
+		ix.Set("example.com.", testZone("example.com.", "ns2.example.net. 192.0.2.3"))
+		checkIndex(t, ix, map[string][]string{
+			"ns1.example.net.": {"example.org."},
+			"ns2.example.net.": {"example.com."},
+			"ns.example.org.":  {"example.org."},
+		}, map[string]map[string][]string{
+			"192.0.2.1": {"ns1.example.net.": {"example.org."}},
+			"192.0.2.3": {
+				"ns.example.org.":  {"example.org."},
+				"ns2.example.net.": {"example.com."},
+			},
+		})
+	})
+
+	t.Run("Upsert", func(t *testing.T) {
+		ix.Upsert("example.com.", testZone("example.com.", "ns1.example.net. 192.0.2.2"), func(exist bool, old, z Zone) Zone {
+			if !exist {
+				t.Error("example.com. not in cache")
+			}
+			z.NSIP = append(z.NSIP, old.NSIP...)
+			return z
+		})
+		checkIndex(t, ix, map[string][]string{
+			"ns1.example.net.": {"example.com.", "example.org."},
+			"ns2.example.net.": {"example.com."},
+			"ns.example.org.":  {"example.org."},
+		}, map[string]map[string][]string{
+			// The zones of the name, at any of its addresses
+			"192.0.2.1": {"ns1.example.net.": {"example.com.", "example.org."}},
+			"192.0.2.2": {"ns1.example.net.": {"example.com.", "example.org."}},
+			"192.0.2.3": {
+				"ns.example.org.":  {"example.org."},
+				"ns2.example.net.": {"example.com."},
+			},
+		})
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		ix.Remove("example.org.")
+		checkIndex(t, ix, map[string][]string{
+			"ns1.example.net.": {"example.com."},
+			"ns2.example.net.": {"example.com."},
+		}, map[string]map[string][]string{
+			"192.0.2.2": {"ns1.example.net.": {"example.com."}},
+			"192.0.2.3": {"ns2.example.net.": {"example.com."}},
+		})
+	})
+
+	t.Run("Pop", func(t *testing.T) {
+		z, ok := ix.Pop("example.com.")
+		if !ok || z.Name != "example.com." {
+			t.Errorf("Pop = %q %v, want example.com. true", z.Name, ok)
+		}
+		checkIndex(t, ix, nil, nil)
+		if _, ok := ix.Pop("example.com."); ok {
+			t.Error("Pop of a removed zone found it")
+		}
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		ix.Set("example.com.", testZone("example.com.", "ns1.example.net. 192.0.2.1"))
+		ix.Clear()
+		if ix.Count() != 0 {
+			t.Errorf("%d zones left", ix.Count())
+		}
+		checkIndex(t, ix, nil, nil)
+	})
+
+	t.Run("Upsert error", func(t *testing.T) {
+		// The index is left as it was
+		ix := NewIndexedZones(failingMap{NewZoneCache()})
+		ix.Set("example.com.", testZone("example.com.", "ns1.example.net. 192.0.2.1"))
+		_, err := ix.Upsert("example.com.", testZone("example.com.", "ns2.example.net. 192.0.2.2"), func(_ bool, _, z Zone) Zone { return z })
+		if err == nil {
+			t.Error("no error")
+		}
+		checkIndex(t, ix, map[string][]string{
+			"ns1.example.net.": {"example.com."},
+		}, map[string]map[string][]string{
+			"192.0.2.1": {"ns1.example.net.": {"example.com."}},
+		})
+	})
+}
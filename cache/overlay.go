@@ -0,0 +1,95 @@
+package cache
+
+// overlayMap
+//
+// Map that reads through to a base Map, but keeps all writes to itself.
+// Used for tests that may use cached data but must not change it.
+type overlayMap[V any] struct {
+	base    Map[V]
+	top     Map[V]
+	removed Map[bool]
+}
+
+// NewOverlayMap creates a Map on top of base. base is never written to.
+func NewOverlayMap[V any](base Map[V]) Map[V] {
+	return &overlayMap[V]{
+		base:    base,
+		top:     NewConcurrentMap[V](),
+		removed: NewConcurrentMap[bool](),
+	}
+}
+
+func (o *overlayMap[V]) Set(key string, value V) {
+	o.top.Set(key, value)
+	o.removed.Remove(key)
+}
+
+func (o *overlayMap[V]) Get(key string) (V, bool) {
+	if v, ok := o.top.Get(key); ok {
+		return v, true
+	}
+	if o.removed.Has(key) {
+		var zero V
+		return zero, false
+	}
+	return o.base.Get(key)
+}
+
+func (o *overlayMap[V]) Remove(key string) {
+	o.top.Remove(key)
+	o.removed.Set(key, true)
+}
+
+func (o *overlayMap[V]) Has(key string) bool {
+	_, ok := o.Get(key)
+	return ok
+}
+
+func (o *overlayMap[V]) Keys() []string {
+	keys := o.top.Keys()
+	for _, k := range o.base.Keys() {
+		if !o.top.Has(k) && !o.removed.Has(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (o *overlayMap[V]) IterBuffered() <-chan Tuple[V] {
+	keys := o.Keys()
+	out := make(chan Tuple[V], len(keys))
+	go func() {
+		for _, k := range keys {
+			if v, ok := o.Get(k); ok {
+				out <- Tuple[V]{Key: k, Value: v}
+			}
+		}
+		close(out)
+	}()
+	return out
+}
+
+func (o *overlayMap[V]) Count() int {
+	return len(o.Keys())
+}
+
+// Clear hides everything, including the content of base.
+func (o *overlayMap[V]) Clear() {
+	for _, k := range o.Keys() {
+		o.removed.Set(k, true)
+	}
+	o.top.Clear()
+}
+
+func (o *overlayMap[V]) Pop(key string) (V, bool) {
+	v, ok := o.Get(key)
+	o.Remove(key)
+	return v, ok
+}
+
+func (o *overlayMap[V]) Upsert(key string, value V, cb UpsertFunc[V]) (V, error) {
+	old, exist := o.Get(key)
+	res := cb(exist, old, value)
+	o.Set(key, res)
+	return res, nil
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot
+//
+// On-disk format of the Zone and Server caches.
+type Snapshot struct {
+	Zones   map[string]Zone   `json:"Zones"`
+	Servers map[string]Server `json:"Servers"`
+}
+
+// SaveFile
+//
+// Write the Zone and Server caches to file as JSON.
+// The file is written to a temporary file first and then renamed,
+// so a crash halfway through never leaves a broken cache file behind.
+func (c *Config) SaveFile(file string) error {
+
+	snap := Snapshot{
+		Zones:   make(map[string]Zone),
+		Servers: make(map[string]Server),
+	}
+	for t := range c.Zones.IterBuffered() {
+		snap.Zones[t.Key] = t.Value
+	}
+	for t := range c.Cache.IterBuffered() {
+		snap.Servers[t.Key] = t.Value
+	}
+
+	js, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(js); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// LoadFile
+//
+// Populate the Zone and Server caches from a file written by SaveFile.
+// The ROOT zone is never overwritten, since it is bootstrapped by Init.
+// A missing file is not an error.
+func (c *Config) LoadFile(file string) error {
+
+	js, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(js, &snap); err != nil {
+		return err
+	}
+
+	for name, zone := range snap.Zones {
+		if name == "." {
+			continue
+		}
+		c.Zones.Set(name, zone)
+	}
+	for name, server := range snap.Servers {
+		c.Cache.Set(name, server)
+	}
+
+	c.Log.Info("Loaded cache from file", "file", file, "zones", len(snap.Zones), "servers", len(snap.Servers))
+
+	return nil
+}
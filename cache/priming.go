@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+	"zonetree/dig"
+
+	"github.com/miekg/dns"
+)
+
+// Bootstrap file for the ROOT zone, in the classic named.root format
+const RootHintsFile = "named.root"
+
+// How long to wait before trying again if priming fails
+const primeRetry = 5 * time.Minute
+
+// Only one priming at a time
+var primeMu sync.Mutex
+
+// LoadRootHints
+//
+// Read the ROOT nameservers from a named.root file in hints/
+// The zone is marked as expired, so that it gets primed on first use.
+func LoadRootHints(file string) (Zone, error) {
+	f, err := os.Open("hints/" + file)
+	if err != nil {
+		return Zone{Name: ".", ZoneCut: "."}, err
+	}
+	defer f.Close()
+	return parseRootHints(f, file)
+}
+
+// parseRootHints
+//
+// Does the work for LoadRootHints. file is only used in messages.
+func parseRootHints(r io.Reader, file string) (Zone, error) {
+
+	var root Zone
+	root.Name = "."
+	root.ZoneCut = "."
+
+	var names []string
+	addrs := make(map[string][]string)
+
+	zp := dns.NewZoneParser(r, ".", file)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch t := rr.(type) {
+		case *dns.NS:
+			if t.Hdr.Name == "." {
+				names = append(names, dns.CanonicalName(t.Ns))
+			}
+		case *dns.A:
+			name := dns.CanonicalName(t.Hdr.Name)
+			addrs[name] = append(addrs[name], t.A.String())
+		case *dns.AAAA:
+			name := dns.CanonicalName(t.Hdr.Name)
+			addrs[name] = append(addrs[name], t.AAAA.String())
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return root, err
+	}
+	if len(names) < 1 {
+		return root, fmt.Errorf("no ROOT NS records in %s", file)
+	}
+
+	root.setRootNS(names, addrs)
+	root.Status = 200
+
+	return root, nil
+}
+
+// setRootNS
+//
+// Fill NSIP and ZoneNS of the ROOT zone. All servers are assumed to
+// serve the same NS set, so every ZoneNS references every NSIP entry.
+func (z *Zone) setRootNS(names []string, addrs map[string][]string) {
+	z.NSIP = nil
+	z.ZoneNS = nil
+
+	var all []int8
+	for _, name := range names {
+		for _, ip := range addrs[name] {
+			all = append(all, z.addNSIP(name, ip))
+		}
+	}
+	for _, id := range all {
+		z.ZoneNS = append(z.ZoneNS, ZoneNS{Self: id, NS: all})
+	}
+}
+
+// RootExpired
+//
+// Check if the ROOT zone needs to be primed.
+func (c *Config) RootExpired() bool {
+	root, ok := c.Zones.Get(".")
+	return !ok || time.Now().After(root.Expires)
+}
+
+// PrimeRoot
+//
+// Prime the ROOT zone according to RFC 8109. Sends ". NS" to the hint
+// servers (fastest first) until one gives a usable answer, and replaces
+// the ROOT zone with the live data. The zone expires with the TTL of the
+// NS RRset. Differences from the hints are kept in Hints of the ROOT zone.
+// If no server answers, the hints are kept and priming is tried again
+// after primeRetry.
+func (c *Config) PrimeRoot() error {
+
+	primeMu.Lock()
+	defer primeMu.Unlock()
+
+	// Someone else may have primed while we were waiting
+	if !c.RootExpired() {
+		return nil
+	}
+
+	hints, err := LoadRootHints(RootHintsFile)
+	if err != nil {
+		return err
+	}
+
+	var nslist map[string]string
+	switch {
+	case c.Opt.IPv4only:
+		nslist = hints.GetNSIP4()
+	case c.Opt.IPv6only:
+		nslist = hints.GetNSIP6()
+	default:
+		nslist = hints.GetNSIP()
+	}
+
+	q := c.NewQuery()
+	q.Qname = "."
+	q.Qtype = "NS"
+	q.DO = true
+
+	var errs []error
+	for _, ip := range c.OrderByRTT(nslist) {
+		q.Nameserver = ip
+		msg, err := c.Query(q, nslist[ip])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ip, err))
+			continue
+		}
+
+		root, err := primingResponse(msg, hints)
+		if err != nil {
+			c.Log.Warn("PRIMING: Unusable priming response", "server", ip, "Error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", ip, err))
+			continue
+		}
+
+		if len(root.Hints) > 0 {
+			c.Log.Warn("PRIMING: ROOT NS set differs from hints", "file", RootHintsFile, "differences", root.Hints)
+		}
+		c.Log.Info("PRIMING: ROOT zone primed", "server", ip, "servers", len(root.NSIP), "expires", root.Expires)
+		root.annotateASN()
+		c.Zones.Set(".", root)
+		return nil
+	}
+
+	// Keep whatever we have (hints, or an earlier priming) for a while
+	root, ok := c.Zones.Get(".")
+	if !ok {
+		root = hints
+	}
+	root.Expires = time.Now().Add(primeRetry)
+	c.Zones.Set(".", root)
+
+	return fmt.Errorf("ROOT priming failed: %w", errors.Join(errs...))
+}
+
+// primingResponse
+//
+// Validate a priming response and turn it into a ROOT zone.
+// Addresses missing from the additional section are taken from hints.
+// Differences from the hints are listed in Hints.
+func primingResponse(msg dig.DigData, hints Zone) (Zone, error) {
+
+	var root Zone
+	root.Name = "."
+	root.ZoneCut = "."
+
+	if msg.Rcode != "NOERROR" {
+		return root, fmt.Errorf("rcode %s", msg.Rcode)
+	}
+	if !msg.AA {
+		return root, errors.New("not authoritative")
+	}
+
+	var names []string
+	var ttl uint32
+	for _, rr := range msg.Answer {
+		if rr.Rtype == "NS" && rr.Name == "." {
+			names = append(names, dns.CanonicalName(rr.GetRdata()))
+			if ttl == 0 || rr.Ttl < ttl {
+				ttl = rr.Ttl
+			}
+		}
+	}
+	if len(names) < 1 {
+		return root, errors.New("no NS RRset for . in answer")
+	}
+
+	addrs := make(map[string][]string)
+	for _, rr := range msg.Additional {
+		name := dns.CanonicalName(rr.Name)
+		if (rr.Rtype == "A" || rr.Rtype == "AAAA") && slices.Contains(names, name) {
+			addrs[name] = append(addrs[name], rr.GetRdata())
+		}
+	}
+	if len(addrs) < 1 {
+		return root, errors.New("no addresses for the ROOT nameservers in additional section")
+	}
+
+	// Not an error, the live data takes precedence. Worth noting though.
+	root.Hints = hintDiff(names, addrs, hints)
+
+	// Fill in from hints for names without addresses in the response
+	missing := slices.DeleteFunc(slices.Clone(names), func(name string) bool { return len(addrs[name]) > 0 })
+	for _, ns := range hints.NSIP {
+		if slices.Contains(missing, ns.Name) {
+			addrs[ns.Name] = append(addrs[ns.Name], ns.IP)
+		}
+	}
+
+	root.setRootNS(names, addrs)
+	root.Status = 200
+	root.Expires = time.Now().Add(time.Duration(ttl) * time.Second)
+
+	return root, nil
+}
+
+// hintDiff
+//
+// List the differences between the ROOT NS names and addresses of a
+// priming response and those of the hints. Names without addresses in
+// the response are only compared by name.
+func hintDiff(names []string, addrs map[string][]string, hints Zone) []string {
+	hintAddrs := make(map[string][]string)
+	for _, ns := range hints.NSIP {
+		hintAddrs[ns.Name] = append(hintAddrs[ns.Name], ns.IP)
+	}
+
+	var diff []string
+	for _, name := range names {
+		h, ok := hintAddrs[name]
+		if !ok {
+			diff = append(diff, "NS not in hints: "+name)
+			continue
+		}
+		a, ok := addrs[name]
+		if !ok {
+			continue
+		}
+		for _, ip := range without(a, h) {
+			diff = append(diff, fmt.Sprintf("Address not in hints: %s %s", name, ip))
+		}
+		for _, ip := range without(h, a) {
+			diff = append(diff, fmt.Sprintf("Address only in hints: %s %s", name, ip))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(hintAddrs)) {
+		if !slices.Contains(names, name) {
+			diff = append(diff, "NS only in hints: "+name)
+		}
+	}
+	return diff
+}
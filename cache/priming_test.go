@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"zonetree/dig"
+)
+
+const testRootHints = `; Two servers is enough for a test
+.                    3600000  NS    A.ROOT-SERVERS.NET.
+A.ROOT-SERVERS.NET.  3600000  A     198.41.0.4
+A.ROOT-SERVERS.NET.  3600000  AAAA  2001:503:ba3e::2:30
+.                    3600000  NS    B.ROOT-SERVERS.NET.
+B.ROOT-SERVERS.NET.  3600000  A     170.247.170.2
+B.ROOT-SERVERS.NET.  3600000  AAAA  2801:1b8:10::b
+`
+
+func TestParseRootHints(t *testing.T) {
+	root, err := parseRootHints(strings.NewReader(testRootHints), "test.root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.NSIP) != 4 || len(root.ZoneNS) != 4 || len(root.GetNSIP()) != 4 {
+		t.Errorf("%d NSIP, %d ZoneNS, %d GetNSIP, want 4", len(root.NSIP), len(root.ZoneNS), len(root.GetNSIP()))
+	}
+	if !root.Expires.IsZero() {
+		t.Errorf("Expires = %v, want hints to be expired", root.Expires)
+	}
+
+	if _, err := parseRootHints(strings.NewReader("A.ROOT-SERVERS.NET. 3600 A 198.41.0.4\n"), "test.root"); err == nil {
+		t.Error("no NS: no error")
+	}
+}
+
+func TestPrimingResponse(t *testing.T) {
+	hints, err := parseRootHints(strings.NewReader(testRootHints), "test.root")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := func(name, rtype, rdata string) dig.DigRR {
+		return dig.DigRR{Name: name, Rtype: rtype, Ttl: 518400, Rdata: []string{rdata}}
+	}
+	ns := func(names ...string) []dig.DigRR {
+		var rrs []dig.DigRR
+		for _, n := range names {
+			rrs = append(rrs, rr(".", "NS", n))
+		}
+		return rrs
+	}
+	a := []dig.DigRR{
+		rr("a.root-servers.net.", "A", "198.41.0.4"),
+		rr("a.root-servers.net.", "AAAA", "2001:503:ba3e::2:30"),
+	}
+	b := []dig.DigRR{
+		rr("b.root-servers.net.", "A", "170.247.170.2"),
+		rr("b.root-servers.net.", "AAAA", "2801:1b8:10::b"),
+	}
+	msg := func(answer, additional []dig.DigRR) dig.DigData {
+		return dig.DigData{Rcode: "NOERROR", AA: true, Answer: answer, Additional: additional}
+	}
+
+	tests := []struct {
+		name  string
+		msg   dig.DigData
+		err   bool
+		nsip  []string
+		hints []string
+	}{
+		{"same as hints", msg(ns("a.root-servers.net.", "b.root-servers.net."), slices.Concat(a, b)), false,
+			[]string{"a.root-servers.net. 198.41.0.4", "a.root-servers.net. 2001:503:ba3e::2:30",
+				"b.root-servers.net. 170.247.170.2", "b.root-servers.net. 2801:1b8:10::b"}, nil},
+		{"addresses from hints", msg(ns("A.ROOT-SERVERS.NET.", "b.root-servers.net."), a), false,
+			[]string{"a.root-servers.net. 198.41.0.4", "a.root-servers.net. 2001:503:ba3e::2:30",
+				"b.root-servers.net. 170.247.170.2", "b.root-servers.net. 2801:1b8:10::b"}, nil},
+		{"renumbered", msg(ns("a.root-servers.net.", "b.root-servers.net."),
+			slices.Concat(a, []dig.DigRR{rr("b.root-servers.net.", "A", "199.9.14.201"), b[1]})), false,
+			[]string{"a.root-servers.net. 198.41.0.4", "a.root-servers.net. 2001:503:ba3e::2:30",
+				"b.root-servers.net. 199.9.14.201", "b.root-servers.net. 2801:1b8:10::b"},
+			[]string{"Address not in hints: b.root-servers.net. 199.9.14.201",
+				"Address only in hints: b.root-servers.net. 170.247.170.2"}},
+		{"new and gone", msg(ns("a.root-servers.net.", "n.root-servers.net."),
+			slices.Concat(a, []dig.DigRR{rr("n.root-servers.net.", "A", "192.0.2.14")})), false,
+			[]string{"a.root-servers.net. 198.41.0.4", "a.root-servers.net. 2001:503:ba3e::2:30",
+				"n.root-servers.net. 192.0.2.14"},
+			[]string{"NS not in hints: n.root-servers.net.", "NS only in hints: b.root-servers.net."}},
+		{"glue for other names ignored", msg(ns("a.root-servers.net."), slices.Concat(a, b)), false,
+			[]string{"a.root-servers.net. 198.41.0.4", "a.root-servers.net. 2001:503:ba3e::2:30"},
+			[]string{"NS only in hints: b.root-servers.net."}},
+		{"refused", dig.DigData{Rcode: "REFUSED"}, true, nil, nil},
+		{"not authoritative", dig.DigData{Rcode: "NOERROR", Answer: ns("a.root-servers.net."), Additional: a}, true, nil, nil},
+		{"no NS", msg(nil, a), true, nil, nil},
+		{"NS for another name", msg([]dig.DigRR{rr("net.", "NS", "a.gtld-servers.net.")}, a), true, nil, nil},
+		{"no addresses", msg(ns("a.root-servers.net."), nil), true, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := primingResponse(tt.msg, hints)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			var nsip []string
+			for ip, name := range root.GetNSIP() {
+				nsip = append(nsip, name+" "+ip)
+			}
+			slices.Sort(nsip)
+			if !slices.Equal(nsip, tt.nsip) {
+				t.Errorf("NSIP = %q, want %q", nsip, tt.nsip)
+			}
+			if !slices.Equal(root.Hints, tt.hints) {
+				t.Errorf("Hints = %q, want %q", root.Hints, tt.hints)
+			}
+			if root.Status != 200 || time.Until(root.Expires) < 518000*time.Second {
+				t.Errorf("Status %d, Expires %v, want 200 and the NS TTL", root.Status, root.Expires)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Directory holding the profiles (YAML files with Options)
+const ProfileDir = "profiles"
+
+// Profile names are plain file names. No paths, no hidden files.
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*\.ya?ml$`)
+
+// Limits used by Validate
+const (
+	minQueryTimeout = 100 * time.Millisecond
+	maxQueryTimeout = 30 * time.Second
+	maxQueryRetries = 10
+)
+
+// ValidProfileName
+//
+// Check that name can be used as a profile file name.
+func ValidProfileName(name string) error {
+	if !profileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: must match %s", name, profileName.String())
+	}
+	return nil
+}
+
+// ListProfiles
+//
+// Get the names of all profiles in ProfileDir
+func ListProfiles() ([]string, error) {
+	entries, err := os.ReadDir(ProfileDir)
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && profileName.MatchString(e.Name()) {
+			list = append(list, e.Name())
+		}
+	}
+	slices.Sort(list)
+	return list, nil
+}
+
+// ParseProfile
+//
+// Parse a YAML profile on top of the default options and validate
+// the result. Unknown keys are errors, so typos don't go unnoticed.
+func ParseProfile(data []byte) (Options, error) {
+	var c Config
+	c.DefaultOptions()
+	opt := c.Opt
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&opt); err != nil {
+		return Options{}, fmt.Errorf("YAML error: %w", err)
+	}
+
+	if err := opt.Validate(); err != nil {
+		return Options{}, err
+	}
+
+	return opt, nil
+}
+
+// ReadProfile
+//
+// Read and validate a profile from ProfileDir.
+func ReadProfile(name string) (Options, error) {
+	if err := ValidProfileName(name); err != nil {
+		return Options{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(ProfileDir, name))
+	if err != nil {
+		return Options{}, err
+	}
+	return ParseProfile(data)
+}
+
+// SaveProfile
+//
+// Validate and write a profile to ProfileDir. The file is written to a
+// temporary file and renamed into place, so a profile is never half written.
+func SaveProfile(name string, data []byte) error {
+	if err := ValidProfileName(name); err != nil {
+		return err
+	}
+	if _, err := ParseProfile(data); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(ProfileDir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(ProfileDir, name))
+}
+
+// Validate
+//
+// Check the options for values that don't make sense.
+// All problems are returned, one per line.
+func (o Options) Validate() error {
+	var errs []error
+
+	if o.IPv4only && o.IPv6only {
+		errs = append(errs, errors.New("IPv4only and IPv6only can not both be true"))
+	}
+
+	for _, r := range o.ResolverList {
+		if net.ParseIP(r) == nil {
+			errs = append(errs, fmt.Errorf("ResolverList: %q is not an IP address", r))
+		}
+	}
+
+	if len(o.QminLabelSequence) < 1 {
+		errs = append(errs, errors.New("QminLabelSequence: needs at least one value"))
+	}
+	for _, l := range o.QminLabelSequence {
+		if l < 1 {
+			errs = append(errs, fmt.Errorf("QminLabelSequence: %d is not a positive number of labels", l))
+		}
+	}
+
+	if o.QueryTimeout < minQueryTimeout || o.QueryTimeout > maxQueryTimeout {
+		errs = append(errs, fmt.Errorf("QueryTimeout: %s is not between %s and %s", o.QueryTimeout, minQueryTimeout, maxQueryTimeout))
+	}
+	if o.QueryRetries < 0 || o.QueryRetries > maxQueryRetries {
+		errs = append(errs, fmt.Errorf("QueryRetries: %d is not between 0 and %d", o.QueryRetries, maxQueryRetries))
+	}
+	if o.QueryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("QueryBackoff: %s is negative", o.QueryBackoff))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ProfileErrorText
+//
+// Format a (joined) validation error for humans.
+func ProfileErrorText(err error) string {
+	return "Profile not valid:\n  " + strings.ReplaceAll(err.Error(), "\n", "\n  ") + "\n"
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"zonetree/dig"
+)
+
+func TestValidProfileName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"default.yaml", true},
+		{"fast_v4-only.1.yml", true},
+		{"../conf.yaml", false},
+		{"../../etc/passwd.yaml", false},
+		{"profiles/conf.yaml", false},
+		{"/etc/conf.yaml", false},
+		{`..\conf.yaml`, false},
+		{".hidden.yaml", false},
+		{"..yaml", false},
+		{"conf.json", false},
+		{"conf.yaml\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidProfileName(tt.name); (err == nil) != tt.ok {
+				t.Errorf("ValidProfileName(%q) = %v, want ok %v", tt.name, err, tt.ok)
+			}
+		})
+	}
+
+	// Nothing is read or written outside ProfileDir
+	outside := filepath.Join("..", "escaped.yaml")
+	if err := SaveProfile("../escaped.yaml", []byte("QueryRetries: 1\n")); err == nil {
+		t.Error("SaveProfile with a path: no error")
+	}
+	if _, err := os.Stat(outside); err == nil {
+		os.Remove(outside)
+		t.Error("SaveProfile wrote outside ProfileDir")
+	}
+	if _, err := ReadProfile("../conf.yaml"); err == nil {
+		t.Error("ReadProfile with a path: no error")
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		err     bool
+		timeout time.Duration
+	}{
+		{"on top of the defaults", "QminStrict: true\n", false, dig.DefaultTimeout},
+		{"empty", "", true, 0},
+		{"timeout", "QueryTimeout: 500ms\n", false, 500 * time.Millisecond},
+		{"unknown field", "QueryTimout: 500ms\n", true, 0},
+		{"wrong case", "querytimeout: 500ms\n", true, 0},
+		{"wrong type", "QueryRetries: many\n", true, 0},
+		{"bad yaml", "QueryTimeout: [\n", true, 0},
+		{"too many retries", "QueryRetries: 99\n", true, 0},
+		{"timeout too short", "QueryTimeout: 1ms\n", true, 0},
+		{"v4 and v6 only", "IPv4only: true\nIPv6only: true\n", true, 0},
+		{"resolver not an IP", "ResolverList: [resolver.example]\n", true, 0},
+		{"no qmin sequence", "QminLabelSequence: []\n", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt, err := ParseProfile([]byte(tt.yaml))
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if err == nil && opt.QueryTimeout != tt.timeout {
+				t.Errorf("QueryTimeout = %s, want %s", opt.QueryTimeout, tt.timeout)
+			}
+		})
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	a := Options{QueryTimeout: time.Second, QueryRetries: 1, QminLabelSequence: []int8{1}}
+	b := Options{QueryTimeout: 2 * time.Second, QueryRetries: 2, QminLabelSequence: []int8{2}}
+
+	cfg := &Config{Opt: a}
+	before := cfg.Snapshot()
+
+	// Snapshots never see half of a switch
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			if i%2 == 0 {
+				cfg.SetOptions(b)
+			} else {
+				cfg.SetOptions(a)
+			}
+		}
+	}()
+	for range 1000 {
+		opt := cfg.Snapshot().Opt
+		if int(opt.QueryTimeout/time.Second) != opt.QueryRetries || int(opt.QminLabelSequence[0]) != opt.QueryRetries {
+			t.Fatalf("mixed options %+v", opt)
+		}
+	}
+	wg.Wait()
+
+	cfg.SetOptions(b)
+	if before.Opt.QueryRetries != 1 {
+		t.Errorf("snapshot taken before the switch has QueryRetries %d, want 1", before.Opt.QueryRetries)
+	}
+	if cfg.Snapshot().Opt.QueryRetries != 2 {
+		t.Errorf("snapshot after the switch has QueryRetries %d, want 2", cfg.Snapshot().Opt.QueryRetries)
+	}
+}
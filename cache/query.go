@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"zonetree/dig"
+)
+
+// BuildStats
+//
+// Counters for the DNS traffic of a build. Only kept when the Config
+// has Stats set (see Compare), otherwise counting is a no-op.
+type BuildStats struct {
+	mu      sync.Mutex
+	Queries int
+	Servers []string // IPs of all servers contacted, in order of first contact
+}
+
+// count
+//
+// Add n queries sent to server to the stats of the Config
+func (c *Config) count(server string, n int) {
+	if c.Stats == nil {
+		return
+	}
+	c.Stats.mu.Lock()
+	defer c.Stats.mu.Unlock()
+	c.Stats.Queries += n
+	if !slices.Contains(c.Stats.Servers, server) {
+		c.Stats.Servers = append(c.Stats.Servers, server)
+	}
+}
+
+// NewQuery
+//
+// Get a dig.NewQuery() with the timing options of the running profile,
+// sent to Port if set
+func (c *Config) NewQuery() dig.Query {
+	q := dig.NewQuery()
+	q.Timeout = c.Opt.QueryTimeout
+	q.Retries = c.Opt.QueryRetries
+	q.Backoff = c.Opt.QueryBackoff
+	if c.Port != "" {
+		q.Port = c.Port
+	}
+	return q
+}
+
+// Query
+//
+// Wrapper for dig.GetDelegation that keeps the SRTT of the server
+// up to date in the global Server cache. With UseCookies, DNS Cookies
+// are sent and remembered, see withCookie.
+func (c *Config) Query(q dig.Query, name string) (dig.DigData, error) {
+	var msg dig.DigData
+	var err error
+	c.withCookie(&q, name, func() (string, string) {
+		msg, err = dig.GetDelegation(q, c.Log)
+		c.count(q.Nameserver, msg.Attempts)
+		c.UpdateRTT(name, q.Nameserver, msg.RTT, err)
+		return msg.Rcode, msg.Cookie
+	})
+	return msg, err
+}
+
+// probe
+//
+// Send a probe query (identity, EDNS, UDP size, cookies). Probes send
+// odd queries on purpose, that servers may well drop, so they are kept
+// out of the SRTT, the build stats and the cookie handling.
+// Picks the IP version from the server address.
+func probe(q dig.Query) (dig.DigOut, error) {
+	if strings.Contains(q.Nameserver, ":") {
+		q.IpVersion = "6"
+	}
+	return dig.Exchange(q)
+}
+
+// LookupAt
+//
+// Look up the IP(s) (A and AAAA) of a name at a given server.
+func (c *Config) LookupAt(name, server string) ([]string, error) {
+	q := c.NewQuery()
+	q.Qname = name
+	q.Nameserver = server
+	iplist, attempts, err := dig.QndQuery(q, c.Log)
+	c.count(server, attempts)
+	return iplist, err
+}
+
+// Resolve
+//
+// Look up the IP(s) of a name using one of the configured resolvers.
+func (c *Config) Resolve(name string) ([]string, error) {
+	return c.LookupAt(name, c.GetResolver())
+}
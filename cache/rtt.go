@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"zonetree/dig"
+	"zonetree/metrics"
+)
+
+// Smoothing and penalty values for the SRTT calculation.
+// Follows the same idea as BIND: new samples are weighted 3/10,
+// and a server that does not answer gets its SRTT doubled.
+const (
+	srttWeightOld  = 7
+	srttWeightNew  = 3
+	srttMax        = 10 * time.Second
+	srttUnknownMax = 32 // Upper limit (ms) of the random SRTT given to untried servers
+)
+
+// ServerRTT
+//
+// Smoothed round trip time for a single IP of a nameserver
+type ServerRTT struct {
+	SRTT     time.Duration `json:"SRTT"`
+	Samples  int           `json:"Samples"`
+	Timeouts int           `json:"Timeouts"`
+	Updated  time.Time     `json:"Updated"`
+}
+
+// UpdateRTT
+//
+// Add an RTT sample (or a timeout if err is set) for ip to the
+// Server cache entry of the nameserver name.
+func (c *Config) UpdateRTT(name, ip string, rtt time.Duration, err error) {
+	if name == "" || ip == "" {
+		return
+	}
+	c.Cache.Upsert(name, Server{}, func(exist bool, s Server, _ Server) Server {
+		// Leave s.IP alone. It holds the resolved address set of the
+		// name, and is used as such by the lookups in zone.go
+		// Copy the map, since readers may hold the old value
+		rtts := make(map[string]ServerRTT, len(s.RTT)+1)
+		for k, v := range s.RTT {
+			rtts[k] = v
+		}
+		rtts[ip] = rtts[ip].add(rtt, err, c.Opt.QueryTimeout)
+		s.RTT = rtts
+		return s
+	})
+}
+
+// SetServerIP
+//
+// Set the resolved address set of the nameserver name in the Server
+// cache, keeping what else is known about it (SRTT, cookies).
+func (c *Config) SetServerIP(name string, ip []string) {
+	c.Cache.Upsert(name, Server{}, func(exist bool, s Server, _ Server) Server {
+		s.IP = ip
+		return s
+	})
+}
+
+// ServerTimeouts
+//
+// List the timeouts of every nameserver address in servers,
+// for the timeouts metric.
+func ServerTimeouts(servers Map[Server]) []metrics.ServerTimeout {
+	var list []metrics.ServerTimeout
+	for t := range servers.IterBuffered() {
+		for ip, r := range t.Value.RTT {
+			if r.Timeouts > 0 {
+				list = append(list, metrics.ServerTimeout{Server: t.Key, IP: ip, Timeouts: r.Timeouts})
+			}
+		}
+	}
+	return list
+}
+
+// add
+//
+// Add an RTT sample, or a timeout if err is set. The first timeout of a
+// server sets the SRTT to timeout, the query timeout in use (or
+// dig.DefaultTimeout if not set). Later ones double it, up to srttMax.
+func (r ServerRTT) add(rtt time.Duration, err error, timeout time.Duration) ServerRTT {
+	switch {
+	case err != nil:
+		r.Timeouts++
+		if r.SRTT == 0 {
+			r.SRTT = cmp.Or(timeout, dig.DefaultTimeout)
+		} else {
+			r.SRTT = min(2*r.SRTT, srttMax)
+		}
+	case r.Samples == 0:
+		r.SRTT = rtt
+		r.Samples++
+	default:
+		r.SRTT = (srttWeightOld*r.SRTT + srttWeightNew*rtt) / (srttWeightOld + srttWeightNew)
+		r.Samples++
+	}
+	r.Updated = time.Now()
+	return r
+}
+
+// SRTT
+//
+// Get the smoothed RTT for ip of the nameserver name.
+func (c *Config) SRTT(name, ip string) (time.Duration, bool) {
+	if s, ok := c.Cache.Get(name); ok {
+		if r, ok := s.RTT[ip]; ok {
+			return r.SRTT, true
+		}
+	}
+	return 0, false
+}
+
+// OrderByRTT
+//
+// Sort a map[ip]name of nameservers with the fastest server first.
+// Servers without SRTT get a small random value (like BIND does) so that
+// they are tried early, but in no particular order.
+func (c *Config) OrderByRTT(nslist map[string]string) []string {
+	srtt := make(map[string]time.Duration, len(nslist))
+	var order []string
+	for ip, name := range nslist {
+		srtt[ip] = c.srttOrRandom(name, ip)
+		order = append(order, ip)
+	}
+	slices.SortFunc(order, func(a, b string) int {
+		return cmp.Compare(srtt[a], srtt[b])
+	})
+	return order
+}
+
+// orderNSIP
+//
+// Same as OrderByRTT, but for the NSIP list of a zone.
+// Returns the indexes of the list, fastest server first.
+func (c *Config) orderNSIP(list []NSIP) []int {
+	srtt := make([]time.Duration, len(list))
+	order := make([]int, len(list))
+	for i, ns := range list {
+		srtt[i] = c.srttOrRandom(ns.Name, ns.IP)
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(srtt[a], srtt[b])
+	})
+	return order
+}
+
+func (c *Config) srttOrRandom(name, ip string) time.Duration {
+	if r, ok := c.SRTT(name, ip); ok {
+		return r
+	}
+	return time.Duration(rand.IntN(srttUnknownMax)+1) * time.Millisecond
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"zonetree/dig"
+	"zonetree/logger"
+)
+
+func TestServerRTTAdd(t *testing.T) {
+	ms := time.Millisecond
+	timeout := errors.New("timeout")
+
+	tests := []struct {
+		name     string
+		r        ServerRTT
+		rtt      time.Duration
+		err      error
+		timeout  time.Duration
+		srtt     time.Duration
+		samples  int
+		timeouts int
+	}{
+		{"first sample", ServerRTT{}, 20 * ms, nil, 0, 20 * ms, 1, 0},
+		{"smoothed", ServerRTT{SRTT: 20 * ms, Samples: 1}, 30 * ms, nil, 0, 23 * ms, 2, 0},
+		{"first timeout", ServerRTT{}, 0, timeout, 800 * ms, 800 * ms, 0, 1},
+		{"first timeout, no timeout set", ServerRTT{}, 0, timeout, 0, dig.DefaultTimeout, 0, 1},
+		{"timeout doubles", ServerRTT{SRTT: 20 * ms, Samples: 1}, 0, timeout, 800 * ms, 40 * ms, 1, 1},
+		{"timeout capped", ServerRTT{SRTT: 8 * time.Second, Timeouts: 3}, 0, timeout, 800 * ms, srttMax, 0, 4},
+		{"sample after timeout", ServerRTT{SRTT: 800 * ms, Timeouts: 1}, 10 * ms, nil, 0, 10 * ms, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.r.add(tt.rtt, tt.err, tt.timeout)
+			if r.SRTT != tt.srtt || r.Samples != tt.samples || r.Timeouts != tt.timeouts {
+				t.Errorf("add() = %v/%d/%d, want %v/%d/%d", r.SRTT, r.Samples, r.Timeouts, tt.srtt, tt.samples, tt.timeouts)
+			}
+			if r.Updated.IsZero() {
+				t.Error("Updated not set")
+			}
+		})
+	}
+}
+
+func TestOrderByRTT(t *testing.T) {
+	cfg := &Config{Log: logger.DummyLogger{}, Zones: NewZoneCache(), Cache: NewServerCache()}
+	cfg.Opt.QueryTimeout = time.Second
+	cfg.UpdateRTT("ns1.example.", "192.0.2.1", 200*time.Millisecond, nil)
+	cfg.UpdateRTT("ns2.example.", "192.0.2.2", 50*time.Millisecond, nil)
+	cfg.UpdateRTT("ns3.example.", "192.0.2.3", 0, errors.New("timeout"))
+
+	if srtt, _ := cfg.SRTT("ns3.example.", "192.0.2.3"); srtt != time.Second {
+		t.Errorf("SRTT after timeout = %v, want the query timeout", srtt)
+	}
+
+	t.Run("OrderByRTT", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			nslist map[string]string
+			want   []string
+		}{
+			{"known", map[string]string{"192.0.2.1": "ns1.example.", "192.0.2.2": "ns2.example.", "192.0.2.3": "ns3.example."},
+				[]string{"192.0.2.2", "192.0.2.1", "192.0.2.3"}},
+			// Untried servers get less than srttUnknownMax, so they go first
+			{"untried first", map[string]string{"192.0.2.1": "ns1.example.", "192.0.2.9": "ns9.example."},
+				[]string{"192.0.2.9", "192.0.2.1"}},
+			{"empty", map[string]string{}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := cfg.OrderByRTT(tt.nslist); !slices.Equal(got, tt.want) {
+					t.Errorf("OrderByRTT() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("orderNSIP", func(t *testing.T) {
+		tests := []struct {
+			name string
+			list []NSIP
+			want []int
+		}{
+			{"known", []NSIP{{Name: "ns3.example.", IP: "192.0.2.3"}, {Name: "ns1.example.", IP: "192.0.2.1"}, {Name: "ns2.example.", IP: "192.0.2.2"}},
+				[]int{2, 1, 0}},
+			// SRTT is per IP, the same name at another address is untried
+			{"per ip", []NSIP{{Name: "ns1.example.", IP: "192.0.2.1"}, {Name: "ns1.example.", IP: "2001:db8::1"}},
+				[]int{1, 0}},
+			{"empty", nil, []int{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got := cfg.orderNSIP(tt.list); !slices.Equal(got, tt.want) {
+					t.Errorf("orderNSIP() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
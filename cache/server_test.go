@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"zonetree/logger"
+)
+
+// testAnswer
+//
+// A response of a test server. Records are in zone file format.
+type testAnswer struct {
+	AA     bool
+	Rcode  int
+	Answer []string
+	Ns     []string
+	Extra  []string
+}
+
+func (a testAnswer) write(t *testing.T, w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetRcode(r, a.Rcode)
+	m.Authoritative = a.AA
+	for _, s := range []struct {
+		rrs []string
+		to  *[]dns.RR
+	}{{a.Answer, &m.Answer}, {a.Ns, &m.Ns}, {a.Extra, &m.Extra}} {
+		for _, rr := range s.rrs {
+			*s.to = append(*s.to, testRR(t, rr))
+		}
+	}
+	w.WriteMsg(m)
+}
+
+func testRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return rr
+}
+
+// testHandler
+//
+// Get the answer of the server at ip for a question
+type testHandler func(ip string, q dns.Question) testAnswer
+
+// testConfig
+//
+// Start a DNS server on each of addrs (127.0.0.x, all of 127/8 is local
+// on Linux), answering with handler. Returns a Config sending its queries
+// there, using the first address as resolver, with a fresh ROOT zone in
+// cache so that nothing gets primed.
+func testConfig(t *testing.T, handler testHandler, addrs ...string) *Config {
+	t.Helper()
+
+	port := "0"
+	for _, addr := range addrs {
+		pc, err := net.ListenPacket("udp", net.JoinHostPort(addr, port))
+		if err != nil {
+			t.Skipf("no test server on %s: %v", addr, err)
+		}
+		port = strconv.Itoa(pc.LocalAddr().(*net.UDPAddr).Port)
+
+		ip := addr
+		started := make(chan struct{})
+		srv := &dns.Server{
+			PacketConn:        pc,
+			NotifyStartedFunc: func() { close(started) },
+			Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+				handler(ip, r.Question[0]).write(t, w, r)
+			}),
+		}
+		go srv.ActivateAndServe()
+		<-started
+		t.Cleanup(func() { srv.Shutdown() })
+	}
+
+	cfg := &Config{Log: logger.DummyLogger{}, Zones: NewZoneCache(), Cache: NewServerCache(), Port: port}
+	cfg.Opt.QueryTimeout = time.Second
+	cfg.Opt.ResolverList = []string{addrs[0]}
+	root := testZone(".", "a.root-servers.net. 198.41.0.4")
+	root.Expires = time.Now().Add(time.Hour)
+	cfg.Zones.Set(".", root)
+	return cfg
+}
+
+// testZone
+//
+// A zone at a zone cut, served by servers ("name ip", ip may be left
+// out), all of them in the delegation from the parent, and all of
+// them answering.
+func testZone(name string, servers ...string) Zone {
+	z := Zone{Name: name, ZoneCut: name, Status: 200}
+	p := ParentNS{ChildStatus: 200}
+	for _, s := range servers {
+		ns, ip, _ := strings.Cut(s, " ")
+		id := z.addNSIP(ns, ip)
+		if ip != "" {
+			z.NSIP[id].ZoneStatus = 200
+		}
+		p.NS = append(p.NS, id)
+		z.ZoneNS = append(z.ZoneNS, ZoneNS{Self: id})
+	}
+	z.ParentNS = []ParentNS{p}
+	return z
+}
+
+// testHost
+//
+// A server name below the zone cut
+func testHost(name, cut string) Zone {
+	return Zone{Name: name, ZoneCut: cut, Status: 204}
+}
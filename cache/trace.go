@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"zonetree/dig"
+)
+
+// TraceStep
+//
+// One query in a trace, i.e. one server at one zone cut.
+type TraceStep struct {
+	Zone        string        `json:"Zone"`     // Zone cut the server was picked from
+	Server      string        `json:"Server"`   // Name of the server
+	IP          string        `json:"IP"`       // IP of the server
+	Rcode       string        `json:"Rcode"`    // Empty if there was no response
+	AA          bool          `json:"AA"`       // Authoritative answer
+	RTT         time.Duration `json:"RTT"`      // Round trip time
+	MsgSize     int           `json:"MsgSize"`  // Size of the response
+	Records     []string      `json:"Records"`  // Answer and Authoritative sections, in master file format
+	Referral    string        `json:"Referral"` // Zone the server referred to, if any
+	Differences []string      `json:"Differences"`
+	Error       string        `json:"Error,omitempty"`
+}
+
+// Trace
+//
+// Result of a dig +trace style walk from the ROOT to the answer.
+type Trace struct {
+	Name  string      `json:"Name"`
+	Qtype string      `json:"Qtype"`
+	Steps []TraceStep `json:"Steps"`
+}
+
+// Trace
+//
+// Walk the zone cuts of name from the ROOT and query the servers at each
+// cut for name/qtype, the way dig +trace does. The servers are taken from
+// the cache, which is (re)built first if any zone on the path is missing or
+// not complete. With all set, every server at each cut is queried, otherwise
+// only the first one (fastest first) that answers.
+// Where a referral does not match the cached delegation, the difference
+// is recorded on the step.
+func (c *Config) Trace(name, qtype string, all bool) Trace {
+
+	name = ToFQDN(strings.ToLower(name))
+	tr := Trace{Name: name, Qtype: strings.ToUpper(qtype)}
+
+	list := dig.Path(name)
+	cuts := append([]string{"."}, c.ZoneCutPath(list)...)
+
+	// Reuse the cache if all delegations on the path are complete
+	fresh := true
+	for _, cut := range cuts[1:] {
+		if z, ok := c.Zones.Get(cut); !ok || !z.Ready() {
+			fresh = false
+		}
+	}
+	if !fresh || len(cuts) < 2 {
+		c.Log.Debug("TRACE: Path not complete in cache. Building", "name", name)
+		BuildZoneCache(name, c)
+		cuts = append([]string{"."}, c.ZoneCutPath(list)...)
+	}
+
+	q := c.NewQuery()
+	q.Qname = name
+	q.Qtype = tr.Qtype
+
+	cut := "."
+	seen := make(map[string]bool)
+	for cut != "" {
+		seen[cut] = true
+		zone, ok := c.Zones.Get(cut)
+		if !ok {
+			tr.Steps = append(tr.Steps, TraceStep{Zone: cut, Error: "zone not in cache"})
+			break
+		}
+
+		// Expected next zone cut, according to the cache
+		var expected string
+		if i := slices.Index(cuts, cut); i >= 0 && i+1 < len(cuts) {
+			expected = cuts[i+1]
+		}
+
+		next := ""
+		for _, ip := range c.OrderByRTT(c.nameservers(&zone)) {
+			q.Nameserver = ip
+			server := zone.nsNameByIP(ip)
+			msg, err := c.Query(q, server)
+
+			step := traceStep(cut, server, ip, msg, err)
+			if step.Referral != "" {
+				step.Differences = c.compareReferral(step.Referral, expected, msg)
+			}
+			tr.Steps = append(tr.Steps, step)
+
+			if err != nil {
+				continue
+			}
+			if next == "" {
+				next = step.Referral
+			}
+			if !all {
+				break
+			}
+		}
+
+		// Stop at the answer, when there is nowhere to go, or on referral loops
+		if next == "" || seen[next] {
+			break
+		}
+		cut = next
+	}
+
+	return tr
+}
+
+// nameservers
+//
+// The servers of a zone to query, according to the IPv4/6 options.
+func (c *Config) nameservers(z *Zone) map[string]string {
+	if c.Opt.IPv4only {
+		return z.GetNSIP4()
+	}
+	if c.Opt.IPv6only {
+		return z.GetNSIP6()
+	}
+	return z.GetNSIP()
+}
+
+// nsNameByIP
+//
+// Get the name of the server with the given IP from the NSIP list.
+func (z *Zone) nsNameByIP(ip string) string {
+	if i := slices.IndexFunc(z.NSIP, func(ns NSIP) bool { return ns.IP == ip }); i >= 0 {
+		return z.NSIP[i].Name
+	}
+	return ""
+}
+
+// traceStep
+//
+// Turn a response into a TraceStep
+func traceStep(cut, server, ip string, msg dig.DigData, err error) TraceStep {
+	step := TraceStep{
+		Zone:    cut,
+		Server:  server,
+		IP:      ip,
+		Rcode:   msg.Rcode,
+		AA:      msg.AA,
+		RTT:     msg.RTT,
+		MsgSize: msg.MsgSize,
+	}
+	if err != nil {
+		step.Error = err.Error()
+		return step
+	}
+
+	for _, rr := range append(msg.Answer, msg.Authoritative...) {
+		step.Records = append(step.Records, fmt.Sprintf("%s\t%d\tIN\t%s\t%s", rr.Name, rr.Ttl, rr.Rtype, rr.GetRdata()))
+	}
+
+	// A referral is a non-authoritative response with NS in the
+	// Authoritative section, and nothing in the Answer section.
+	if !msg.AA && len(msg.Answer) < 1 {
+		for _, rr := range msg.Authoritative {
+			if rr.Rtype == "NS" {
+				step.Referral = strings.ToLower(rr.Name)
+				break
+			}
+		}
+	}
+
+	return step
+}
+
+// compareReferral
+//
+// Compare a live referral with what the cache holds for the delegation.
+func (c *Config) compareReferral(referral, expected string, msg dig.DigData) []string {
+	var diff []string
+
+	if referral != expected {
+		diff = append(diff, fmt.Sprintf("Referral to %s, cache expects %s", referral, expected))
+	}
+
+	zone, ok := c.Zones.Get(referral)
+	if !ok {
+		return append(diff, "Referred zone "+referral+" not in cache")
+	}
+
+	var live []string
+	for _, rr := range msg.Authoritative {
+		if rr.Rtype == "NS" && strings.EqualFold(rr.Name, referral) {
+			live = append(live, strings.ToLower(rr.GetRdata()))
+		}
+	}
+	slices.Sort(live)
+	live = slices.Compact(live)
+
+	var cached []string
+	for _, p := range zone.ParentNS {
+		if p.ChildStatus == 200 {
+			cached = append(cached, zone.nsNames(p.NS)...)
+		}
+	}
+	slices.Sort(cached)
+	cached = slices.Compact(cached)
+
+	if !slices.Equal(live, cached) {
+		diff = append(diff, fmt.Sprintf("NS for %s differ from cache. Live only: [%s] Cache only: [%s]", referral,
+			strings.Join(without(live, cached), " "), strings.Join(without(cached, live), " ")))
+	}
+
+	return diff
+}
+
+// String
+//
+// Format the trace as a dig +trace transcript.
+func (t Trace) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "; <<>> zonetree trace <<>> %s %s\n", t.Name, t.Qtype)
+	for _, s := range t.Steps {
+		b.WriteString("\n")
+		if s.Error != "" {
+			fmt.Fprintf(&b, ";; %s: no response from %s#53(%s): %s\n", s.Zone, s.IP, s.Server, s.Error)
+			continue
+		}
+		for _, rr := range s.Records {
+			b.WriteString(rr + "\n")
+		}
+		fmt.Fprintf(&b, ";; Received %d bytes from %s#53(%s) in %d ms (%s)\n", s.MsgSize, s.IP, s.Server, s.RTT.Milliseconds(), s.Rcode)
+		for _, d := range s.Differences {
+			b.WriteString(";; DIFFERS FROM CACHE: " + d + "\n")
+		}
+	}
+
+	return b.String()
+}
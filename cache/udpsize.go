@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Buffer sizes advertised by the UDP size probe
+var udpSizes = []uint16{512, 1232, 1400, 4096}
+
+// Largest UDP response that is safe from fragmentation, as recommended
+// by DNS Flag Day 2020
+const flagDaySize = 1232
+
+// Largest DNS payload that fits in one packet on a 1500 byte MTU link,
+// after the IP and UDP headers
+const (
+	maxUnfragmented4 = 1500 - 20 - 8
+	maxUnfragmented6 = 1500 - 40 - 8
+)
+
+// UDPSizeTest
+//
+// One query at one advertised buffer size.
+// Response is the size of the response in bytes, 0 if there was none.
+type UDPSizeTest struct {
+	Size     uint16 `json:"Size"`
+	Response int    `json:"Response"`
+	TC       bool   `json:"TC"`
+	Result   string `json:"Result"` // EdnsOK, EdnsFail or EdnsTimeout
+	Detail   string `json:"Detail,omitempty"`
+}
+
+// UDPSizeResult
+//
+// UDP size behaviour of one server. Child servers are asked for the
+// DNSKEY of the zone, parent servers for the delegation (a referral).
+// Full is the size of the complete response over TCP, ServerSize the
+// buffer size the server advertises in its OPT.
+type UDPSizeResult struct {
+	Name       string        `json:"Name"`
+	IP         string        `json:"IP"`
+	Qtype      string        `json:"Qtype"`
+	Referral   bool          `json:"Referral"`
+	Tests      []UDPSizeTest `json:"Tests"`
+	TCP        string        `json:"TCP"` // EdnsOK, EdnsFail or EdnsTimeout
+	Full       int           `json:"Full"`
+	ServerSize uint16        `json:"ServerSize"`
+	Fragments  bool          `json:"Fragments"` // Advertises more than flagDaySize, or sent a response larger than the path MTU
+	Warnings   []string      `json:"Warnings"`
+}
+
+// ProbeUDPSize
+//
+// Measure the response sizes of the zone's servers (DNSKEY) and of the
+// parent servers (referral) at different buffer sizes, and store the
+// results on the zone.
+func (z *Zone) ProbeUDPSize(cfg *Config) {
+	z.UDPSize = nil
+	var seen []string
+	for _, ns := range z.NSIP {
+		if !cfg.probeable(ns) || slices.Contains(seen, ns.IP) {
+			continue
+		}
+		seen = append(seen, ns.IP)
+		z.UDPSize = append(z.UDPSize, cfg.UDPSize(ns.Name, ns.IP, z.Name, "DNSKEY"))
+	}
+	seen = nil
+	for _, p := range z.ParentNS {
+		if !cfg.probeable(NSIP{Name: p.Name, IP: p.IP}) || slices.Contains(seen, p.IP) {
+			continue
+		}
+		seen = append(seen, p.IP)
+		r := cfg.UDPSize(p.Name, p.IP, z.Name, "NS")
+		r.Referral = true
+		z.UDPSize = append(z.UDPSize, r)
+	}
+}
+
+// UDPSize
+//
+// Send qname/qtype, with DO, to the server at ip at each of the
+// udpSizes, as is (see FixedUDPsize), and once over TCP.
+func (c *Config) UDPSize(name, ip, qname, qtype string) UDPSizeResult {
+	r := UDPSizeResult{Name: name, IP: ip, Qtype: qtype}
+
+	q := c.NewQuery()
+	q.Nameserver = ip
+	q.Qname = qname
+	q.Qtype = qtype
+	q.DO = true
+	q.FixedUDPsize = true
+
+	for _, size := range udpSizes {
+		q.UDPsize = size
+		t := UDPSizeTest{Size: size, Result: EdnsOK}
+
+		out, err := probe(q)
+		if err != nil {
+			t.Result = errResult(err)
+			t.Detail = err.Error()
+			if t.Result == EdnsFail {
+				t.Detail = fmt.Sprintf("unreadable response to %d byte buffer: %s", size, err)
+			}
+			r.Tests = append(r.Tests, t)
+			continue
+		}
+		msg := out.Response
+		t.Response = out.MsgSize
+		t.TC = msg.Truncated
+		if opt := msg.IsEdns0(); opt != nil {
+			r.ServerSize = opt.UDPSize()
+		}
+
+		switch {
+		case t.Response > int(size) && !t.TC:
+			t.Result = EdnsFail
+			t.Detail = fmt.Sprintf("%d byte response to %d byte buffer without TC", t.Response, size)
+		case t.Response > int(max(size, dns.MinMsgSize)):
+			t.Result = EdnsFail
+			t.Detail = fmt.Sprintf("%d byte truncated response to %d byte buffer", t.Response, size)
+		}
+		r.Tests = append(r.Tests, t)
+	}
+
+	q.Transport = "tcp"
+	q.UDPsize = dns.DefaultMsgSize
+	out, err := probe(q)
+	switch {
+	case err != nil:
+		r.TCP = errResult(err)
+	case out.Response.Rcode != dns.RcodeSuccess || out.Response.Truncated:
+		r.TCP = EdnsFail
+	default:
+		r.TCP = EdnsOK
+		r.Full = out.MsgSize
+	}
+
+	ipv6 := strings.Contains(ip, ":")
+	r.Fragments = r.ServerSize > flagDaySize || r.largest() > pathMTU(ipv6)
+	r.Warnings = r.warnings(ipv6)
+
+	c.Log.Debug("UDP size", "Server", name, "IP", ip, "Qtype", qtype, "Warnings", r.Warnings)
+
+	return r
+}
+
+// pathMTU
+//
+// Get the largest DNS payload that is not fragmented on a 1500 byte MTU.
+func pathMTU(ipv6 bool) int {
+	if ipv6 {
+		return maxUnfragmented6
+	}
+	return maxUnfragmented4
+}
+
+// largest
+//
+// Get the size of the largest UDP response.
+func (r UDPSizeResult) largest() int {
+	n := 0
+	for _, t := range r.Tests {
+		n = max(n, t.Response)
+	}
+	return n
+}
+
+// warnings
+//
+// Explain what is wrong with the results.
+func (r UDPSizeResult) warnings(ipv6 bool) []string {
+	var w []string
+
+	if r.TCP != EdnsOK {
+		w = append(w, "DNS over TCP does not work ("+r.TCP+")")
+	}
+	if mtu := pathMTU(ipv6); r.largest() > mtu {
+		w = append(w, fmt.Sprintf("Sends UDP responses larger than %d bytes, that are fragmented on a 1500 byte MTU", mtu))
+	}
+	if r.ServerSize > flagDaySize {
+		w = append(w, fmt.Sprintf("Advertises a %d byte buffer", r.ServerSize))
+	}
+
+	// Answers small, but not large, are most likely lost fragments
+	var answered bool
+	for _, t := range r.Tests {
+		if t.Result == EdnsFail {
+			w = append(w, t.Detail)
+		}
+		if t.Result == EdnsOK {
+			answered = true
+		}
+		if t.Result == EdnsTimeout && answered {
+			w = append(w, fmt.Sprintf("No response at %d bytes, large responses are lost", t.Size))
+			break
+		}
+	}
+
+	return w
+}
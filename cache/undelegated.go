@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Host names as allowed for nameservers (RFC 952/1123), fully qualified
+var hostName = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)+$`)
+
+// Name used for the ParentNS entry holding the operator supplied delegation
+const UndelegatedParent = "undelegated"
+
+// UndelegatedNS
+//
+// A nameserver of an undelegated zone, with optional glue.
+type UndelegatedNS struct {
+	Name string   `json:"Name"`
+	IP   []string `json:"IP"`
+}
+
+// Undelegated
+//
+// Delegation data for a zone that is not (yet) delegated in the DNS.
+// DS records are given as RDATA only, i.e. "keytag algorithm digesttype digest".
+type Undelegated struct {
+	Zone string          `json:"Zone"`
+	NS   []UndelegatedNS `json:"NS"`
+	DS   []string        `json:"DS"`
+}
+
+// Validate
+//
+// Check that the supplied delegation data can be used.
+func (u *Undelegated) Validate() error {
+	var errs []error
+
+	if _, ok := dns.IsDomainName(u.Zone); !ok || u.Zone == "" {
+		errs = append(errs, fmt.Errorf("Zone: %q is not a domain name", u.Zone))
+	}
+	if len(u.NS) < 1 {
+		errs = append(errs, errors.New("NS: at least one nameserver is needed"))
+	}
+	for _, ns := range u.NS {
+		if !hostName.MatchString(ToFQDN(ns.Name)) {
+			errs = append(errs, fmt.Errorf("NS: %q is not a valid host name", ns.Name))
+		}
+		for _, ip := range ns.IP {
+			if net.ParseIP(ip) == nil {
+				errs = append(errs, fmt.Errorf("NS: %q (%s) is not an IP address", ip, ns.Name))
+			}
+		}
+	}
+	for _, ds := range u.DS {
+		rr, err := dns.NewRR(dns.Fqdn(u.Zone) + " IN DS " + ds)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DS: %q: %v", ds, err))
+			continue
+		}
+		if _, err := hex.DecodeString(rr.(*dns.DS).Digest); err != nil {
+			errs = append(errs, fmt.Errorf("DS: %q: digest is not hex", ds))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Overlay
+//
+// Get a snapshot of the Config where the caches read from c, but
+// all writes stay in the snapshot.
+func (c *Config) Overlay() *Config {
+	n := c.Snapshot()
+	n.Zones = NewOverlayMap(c.Zones)
+	n.Cache = NewOverlayMap(c.Cache)
+	return n
+}
+
+// TestUndelegated
+//
+// Test a zone as if the parent had delegated it to the supplied nameservers.
+// The operator supplied data takes the place of the parent nameservers in
+// ParentNS, after which the zone is processed as any other zone.
+// The supplied delegation says nothing about the zone itself, so the status
+// is only 200 if one of the servers answers for it. Supplied DS records are
+// checked against the DNSKEYs the servers return, see DSMismatch.
+// The shared caches are only read, never written to.
+func (c *Config) TestUndelegated(u Undelegated) (Zone, error) {
+
+	if err := u.Validate(); err != nil {
+		return Zone{}, err
+	}
+
+	rcfg := c.Overlay()
+	// The DNSKEYs are needed to check the DS
+	if len(u.DS) > 0 {
+		rcfg.Opt.QueryApex = true
+	}
+
+	var zone Zone
+	zone.Name = ToFQDN(dns.CanonicalName(u.Zone))
+	zone.Status = 201
+
+	parent := ParentNS{
+		Name:        UndelegatedParent,
+		DS:          u.DS,
+		ChildStatus: 200,
+	}
+
+	for _, ns := range u.NS {
+		name := ToFQDN(dns.CanonicalName(ns.Name))
+		iplist := ns.IP
+
+		// Supplied addresses are the glue of the delegation
+		for _, ip := range iplist {
+			parent.Glue = append(parent.Glue, glueEntry(name, ip))
+		}
+
+		// No glue given. Look for the server in cache, then ask a resolver.
+		if len(iplist) < 1 {
+			if server, ok := rcfg.Cache.Get(name); ok {
+				iplist = append(iplist, server.IP...)
+			}
+		}
+		resolved := false
+		if len(iplist) < 1 {
+			rcfg.Log.Debug("UNDELEGATED: No glue for nameserver. Querying resolver.", "Name", name)
+			iplist, _ = rcfg.Resolve(name)
+			resolved = len(iplist) > 0
+		}
+		if len(iplist) < 1 {
+			rcfg.Log.Debug("UNDELEGATED: Unable to find IP for nameserver", "Name", name)
+		}
+
+		for _, ip := range iplist {
+			id := zone.addNSIP(name, ip)
+			zone.NSIP[id].Resolved = resolved
+			parent.NS = append(parent.NS, id)
+		}
+	}
+	slices.Sort(parent.NS)
+	zone.ParentNS = append(zone.ParentNS, parent)
+
+	// QuerySelfForNS sets 200 on the first authoritative answer
+	zone.Status = 206
+	err := zone.QuerySelfForNS(rcfg, false)
+
+	if zone.Status == 200 {
+		zone.analyze(rcfg, StripLabelFromLeft(zone.Name))
+		zone.DSMismatch = zone.checkDS(u.DS)
+	}
+
+	rcfg.Zones.Set(zone.Name, zone)
+
+	return zone, err
+}
+
+// checkDS
+//
+// Get the DS records (as given) that match none of the DNSKEYs the
+// servers of the zone returned.
+func (z *Zone) checkDS(dslist []string) []string {
+	var keys []*dns.DNSKEY
+	for _, zns := range z.ZoneNS {
+		for _, k := range zns.DNSKEY {
+			if rr, err := dns.NewRR(z.Name + " IN DNSKEY " + k); err == nil {
+				keys = append(keys, rr.(*dns.DNSKEY))
+			}
+		}
+	}
+
+	var mismatch []string
+	for _, ds := range dslist {
+		rr, err := dns.NewRR(z.Name + " IN DS " + ds)
+		if err != nil {
+			mismatch = append(mismatch, ds)
+			continue
+		}
+		want := rr.(*dns.DS)
+		if !slices.ContainsFunc(keys, func(k *dns.DNSKEY) bool {
+			got := k.ToDS(want.DigestType)
+			return got != nil && got.KeyTag == want.KeyTag && got.Algorithm == want.Algorithm &&
+				strings.EqualFold(got.Digest, want.Digest)
+		}) {
+			mismatch = append(mismatch, ds)
+		}
+	}
+	return mismatch
+}
+
+// addNSIP
+//
+// Get the index of the name <-> ip pair in the NSIP list,
+// adding it if it is not already there.
+func (z *Zone) addNSIP(name, ip string) int8 {
+	id := slices.IndexFunc(z.NSIP, func(ns NSIP) bool {
+		return ns.Name == name && ns.IP == ip
+	})
+	if id < 0 {
+		z.NSIP = append(z.NSIP, NSIP{Name: name, IP: ip})
+		id = len(z.NSIP) - 1
+	}
+	return int8(id)
+}
@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"errors"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"zonetree/dig"
+)
+
+// Failure
+//
+// What to take down in a what-if simulation.
+// IPs		- Addresses, or prefixes in CIDR notation.
+// Providers	- Domains whose nameservers all fail, e.g. "cloudflare.com".
+// IPv6		- All IPv6 addresses fail.
+type Failure struct {
+	IPs       []string `json:"IPs"`
+	Providers []string `json:"Providers"`
+	IPv6      bool     `json:"IPv6"`
+}
+
+// ZoneImpact
+//
+// What a failure does to one zone.
+type ZoneImpact struct {
+	Zone    string   `json:"Zone"`
+	Impact  string   `json:"Impact"`  // down or degraded
+	Servers int      `json:"Servers"` // Working server addresses before the failure
+	Left    int      `json:"Left"`    // and after
+	Lost    []string `json:"Lost"`    // Servers that failed
+	Reason  string   `json:"Reason,omitempty"`
+}
+
+// Impact
+//
+// Result of a what-if simulation over the cached zones.
+// Colors maps zone names and server labels (name (IP)) to
+// red (down), orange (degraded) or green (ok), for the tree view.
+type Impact struct {
+	Failure    Failure           `json:"Failure"`
+	Down       []ZoneImpact      `json:"Down"`
+	Degraded   []ZoneImpact      `json:"Degraded"`
+	Unaffected int               `json:"Unaffected"`
+	Colors     map[string]string `json:"Colors"`
+}
+
+// Impact colors
+const (
+	ColorDown     = "red"
+	ColorDegraded = "orange"
+	ColorOK       = "green"
+)
+
+// failure
+//
+// Parsed Failure
+type failure struct {
+	prefixes  []netip.Prefix
+	providers []string
+	ipv6      bool
+}
+
+// parse
+//
+// Check and parse the Failure.
+func (f Failure) parse() (failure, error) {
+	var pf failure
+	var errs []error
+
+	for _, s := range f.IPs {
+		if p, err := netip.ParsePrefix(s); err == nil {
+			pf.prefixes = append(pf.prefixes, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			errs = append(errs, errors.New("IPs: not an address or prefix: "+s))
+			continue
+		}
+		pf.prefixes = append(pf.prefixes, netip.PrefixFrom(a, a.BitLen()))
+	}
+	for _, p := range f.Providers {
+		if _, ok := dns.IsDomainName(p); !ok || p == "" {
+			errs = append(errs, errors.New("Providers: not a domain name: "+p))
+			continue
+		}
+		pf.providers = append(pf.providers, ToFQDN(strings.ToLower(p)))
+	}
+	pf.ipv6 = f.IPv6
+
+	if len(pf.prefixes) < 1 && len(pf.providers) < 1 && !pf.ipv6 {
+		errs = append(errs, errors.New("nothing to fail"))
+	}
+
+	return pf, errors.Join(errs...)
+}
+
+// down
+//
+// Check if the server name/ip is taken down by the failure
+func (pf failure) down(name, ip string) bool {
+	name = strings.ToLower(name)
+	for _, p := range pf.providers {
+		if dns.IsSubDomain(p, name) {
+			return true
+		}
+	}
+	a, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	a = a.Unmap()
+	if pf.ipv6 && a.Is6() {
+		return true
+	}
+	for _, p := range pf.prefixes {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// WhatIf
+//
+// Simulate the failure against the cached zones, without sending any
+// queries. A zone is down if it can no longer be resolved, i.e. all its
+// servers are down, or can't be found because the zones their names
+// are in are down, or its parent is down. A zone that still resolves,
+// but lost servers, is degraded.
+func (c *Config) WhatIf(f Failure) (Impact, error) {
+
+	pf, err := f.parse()
+	if err != nil {
+		return Impact{}, err
+	}
+
+	im := Impact{Failure: f, Colors: make(map[string]string)}
+	ds := c.cachedDepSet()
+
+	// All addresses of each server name, from all zones
+	addrs := make(map[string][]string)
+	for t := range c.Zones.IterBuffered() {
+		for _, ns := range t.Value.NSIP {
+			name := strings.ToLower(ns.Name)
+			if ns.IP != "" && !slices.Contains(addrs[name], ns.IP) {
+				addrs[name] = append(addrs[name], ns.IP)
+			}
+		}
+	}
+
+	// A server name fails when all of its addresses do
+	failedNames := make(map[string]bool)
+	for name, ips := range addrs {
+		failedNames[name] = !slices.ContainsFunc(ips, func(ip string) bool { return !pf.down(name, ip) })
+	}
+	for _, dz := range ds.zones {
+		for _, s := range dz.servers {
+			if _, ok := addrs[s]; !ok && pf.down(s, "") {
+				failedNames[s] = true
+			}
+		}
+	}
+
+	before := ds.resolved(func(string) bool { return false })
+	after := ds.resolved(func(id string) bool {
+		name, ok := strings.CutPrefix(id, "server:")
+		return ok && failedNames[name]
+	})
+
+	for _, cut := range slices.Sorted(maps.Keys(ds.zones)) {
+		z, ok := c.Zones.Get(cut)
+		if !ok {
+			continue
+		}
+
+		zi := ZoneImpact{Zone: cut}
+		for _, ns := range z.NSIP {
+			if ns.IP == "" || slices.Contains([]int32{403, 404, 500, 508}, ns.ZoneStatus) {
+				continue
+			}
+			label := serverLabel(strings.ToLower(ns.Name), ns.IP)
+			zi.Servers++
+			if pf.down(ns.Name, ns.IP) {
+				zi.Lost = append(zi.Lost, label)
+				im.Colors[label] = ColorDown
+			} else {
+				zi.Left++
+				im.Colors[label] = ColorOK
+			}
+		}
+
+		switch {
+		case before[cut] && !after[cut]:
+			zi.Impact = "down"
+			zi.Reason = ds.reason(cut, after, failedNames)
+			im.Down = append(im.Down, zi)
+			im.Colors[cut] = ColorDown
+		case len(zi.Lost) > 0:
+			zi.Impact = "degraded"
+			im.Degraded = append(im.Degraded, zi)
+			im.Colors[cut] = ColorDegraded
+		default:
+			im.Unaffected++
+			im.Colors[cut] = ColorOK
+		}
+	}
+
+	return im, nil
+}
+
+// reason
+//
+// Explain why a zone no longer resolves.
+func (ds depSet) reason(cut string, ok map[string]bool, failedNames map[string]bool) string {
+	dz := ds.zones[cut]
+	if dz.parent != "" && !ok[dz.parent] {
+		return "parent " + dz.parent + " is down"
+	}
+	var hosts []string
+	for _, s := range dz.servers {
+		if failedNames[s] {
+			continue
+		}
+		if h := ds.hosts[s]; h != "" && !slices.Contains(hosts, h) {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) > 0 {
+		return "servers left are in zones that are down: " + strings.Join(hosts, " ")
+	}
+	return "all servers are down"
+}
+
+// cachedDepSet
+//
+// Get the dependencies between all zones in the cache, without
+// building anything.
+func (c *Config) cachedDepSet() depSet {
+	ds := depSet{zones: make(map[string]*depZone), hosts: make(map[string]string)}
+
+	for t := range c.Zones.IterBuffered() {
+		z := t.Value
+		if t.Key != "." && (z.ZoneCut != t.Key || len(z.NSIP) < 1) {
+			continue
+		}
+		dz := &depZone{}
+		if t.Key != "." {
+			dz.parent = "."
+			if cuts := c.ZoneCutPath(dig.Path(StripLabelFromLeft(t.Key))); len(cuts) > 0 {
+				dz.parent = cuts[len(cuts)-1]
+			}
+		}
+		dz.servers, dz.glue = z.servers(dz.parent)
+		ds.zones[t.Key] = dz
+	}
+
+	// Parents not in cache get the benefit of the doubt
+	for _, dz := range ds.zones {
+		if _, ok := ds.zones[dz.parent]; dz.parent != "" && !ok {
+			ds.zones[dz.parent] = &depZone{unknown: true}
+		}
+	}
+
+	for cut, dz := range ds.zones {
+		if cut == "." {
+			continue
+		}
+		for _, s := range dz.servers {
+			if _, ok := ds.hosts[s]; ok || !c.Zones.Has(s) {
+				continue
+			}
+			ds.hosts[s] = "."
+			if cuts := c.ZoneCutPath(dig.Path(s)); len(cuts) > 0 {
+				ds.hosts[s] = cuts[len(cuts)-1]
+			}
+		}
+	}
+
+	return ds
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+
+	"zonetree/logger"
+)
+
+func TestFailureParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		f         Failure
+		prefixes  []string
+		providers []string
+		err       bool
+	}{
+		{"address", Failure{IPs: []string{"192.0.2.1"}}, []string{"192.0.2.1/32"}, nil, false},
+		{"v6 address", Failure{IPs: []string{"2001:db8::1"}}, []string{"2001:db8::1/128"}, nil, false},
+		{"prefix is masked", Failure{IPs: []string{"192.0.2.77/24"}}, []string{"192.0.2.0/24"}, nil, false},
+		{"provider", Failure{Providers: []string{"Example.NET"}}, nil, []string{"example.net."}, false},
+		{"ipv6 only", Failure{IPv6: true}, nil, nil, false},
+		{"bad address", Failure{IPs: []string{"192.0.2"}}, nil, nil, true},
+		{"empty provider", Failure{Providers: []string{""}}, nil, nil, true},
+		{"nothing", Failure{}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pf, err := tt.f.parse()
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			var prefixes []string
+			for _, p := range pf.prefixes {
+				prefixes = append(prefixes, p.String())
+			}
+			if !slices.Equal(prefixes, tt.prefixes) {
+				t.Errorf("prefixes = %v, want %v", prefixes, tt.prefixes)
+			}
+			if !slices.Equal(pf.providers, tt.providers) {
+				t.Errorf("providers = %v, want %v", pf.providers, tt.providers)
+			}
+		})
+	}
+}
+
+func TestWhatIf(t *testing.T) {
+	cfg := &Config{Log: logger.DummyLogger{}, Zones: NewZoneCache(), Cache: NewServerCache()}
+
+	// . -> se. (glue, v4 and v6) -> example.se. (out of bailiwick servers)
+	cfg.Zones.Set(".", Zone{Name: ".", ZoneCut: ".", Status: 200,
+		NSIP: []NSIP{{Name: "a.root-servers.net.", IP: "198.41.0.4"}}})
+	cfg.Zones.Set("se.", Zone{Name: "se.", ZoneCut: "se.", Status: 200,
+		NSIP:     []NSIP{{Name: "ns1.se.", IP: "192.0.2.1"}, {Name: "ns2.se.", IP: "2001:db8::1"}},
+		ParentNS: []ParentNS{{ChildStatus: 200, NS: []int8{0, 1}}}})
+	cfg.Zones.Set("example.se.", Zone{Name: "example.se.", ZoneCut: "example.se.", Status: 200,
+		NSIP:     []NSIP{{Name: "ns1.provider.net.", IP: "203.0.113.1"}, {Name: "ns2.provider.net.", IP: "203.0.113.2"}},
+		ParentNS: []ParentNS{{ChildStatus: 200, NS: []int8{0, 1}}}})
+
+	tests := []struct {
+		name     string
+		f        Failure
+		down     []string
+		degraded []string
+	}{
+		{"provider network", Failure{IPs: []string{"203.0.113.0/24"}}, []string{"example.se."}, nil},
+		{"one provider server", Failure{IPs: []string{"203.0.113.1"}}, nil, []string{"example.se."}},
+		{"ipv6", Failure{IPv6: true}, nil, []string{"se."}},
+		{"parent down", Failure{Providers: []string{"se"}}, []string{"example.se.", "se."}, nil},
+		{"unrelated", Failure{IPs: []string{"10.0.0.0/8"}}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im, err := cfg.WhatIf(tt.f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var down, degraded []string
+			for _, zi := range im.Down {
+				down = append(down, zi.Zone)
+			}
+			for _, zi := range im.Degraded {
+				degraded = append(degraded, zi.Zone)
+			}
+			if !slices.Equal(down, tt.down) {
+				t.Errorf("down = %v, want %v", down, tt.down)
+			}
+			if !slices.Equal(degraded, tt.degraded) {
+				t.Errorf("degraded = %v, want %v", degraded, tt.degraded)
+			}
+		})
+	}
+
+	if _, err := cfg.WhatIf(Failure{}); err == nil {
+		t.Error("empty failure: no error")
+	}
+}
@@ -3,10 +3,12 @@ package cache
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"maps"
 	"slices"
 	"strings"
+	"time"
 	"zonetree/dig"
+	"zonetree/metrics"
 
 	"github.com/miekg/dns"
 )
@@ -20,55 +22,77 @@ var ZoneStatus = map[int32]string{
 	204: "Not a Zone",      // Either a hostname or an empty non-terminal
 	206: "Zone incomplete", // Zone have not yet been, or could not be, entierly processed
 	207: "Zone OK-ish?",    // Multi-Status - No consensus on status
+	301: "Alias",           // CNAME, or below a DNAME. See Zone.Alias
 	403: "REFUSED",
 	404: "NXDOMAIN",
 	420: "Just say no",      // What even is this?
 	422: "Unable to comply", // Unprocessable. Most likely disallowed due to Config option.
 	500: "Server error",
+	508: "Loop detected", // Servers can't be found without glue that is missing, or only through a cycle. See Zone.Cycles
 }
 
 // Zone
 //
 // This struct holds all relevant data for a zone.
 type Zone struct {
-	Name     string     `json:"Name"`     // Name of the Zone
-	ZoneNS   []ZoneNS   `json:"NS"`       // All NS from all instances of the Authoritative name servers
-	ZoneCut  string     `json:"ZoneCut"`  // Zone the record belongs to (in case of hosts and empty non-terminals)
-	ParentNS []ParentNS `json:"ParentNS"` // All NS in all instances from the name servers of the Parent Zone (i.e. delegations)
-	NSIP     []NSIP     `json:"NSIP"`     // All NS Name <-> IP pairs found in both delegation and in Authoritative name servers
-	Status   int32      `json:"Status"`   // See ZoneStatus
+	Name       string          `json:"Name"`                 // Name of the Zone
+	ZoneNS     []ZoneNS        `json:"NS"`                   // All NS from all instances of the Authoritative name servers
+	ZoneCut    string          `json:"ZoneCut"`              // Zone the record belongs to (in case of hosts and empty non-terminals)
+	ParentNS   []ParentNS      `json:"ParentNS"`             // All NS in all instances from the name servers of the Parent Zone (i.e. delegations)
+	NSIP       []NSIP          `json:"NSIP"`                 // All NS Name <-> IP pairs found in both delegation and in Authoritative name servers
+	Status     int32           `json:"Status"`               // See ZoneStatus
+	Expires    time.Time       `json:"Expires"`              // When the data should be refreshed. Zero if unknown
+	Alias      string          `json:"Alias,omitempty"`      // Target name, if the name is an alias (status 301)
+	AliasRR    string          `json:"AliasRR,omitempty"`    // CNAME or DNAME
+	Cycles     [][]string      `json:"Cycles,omitempty"`     // Circular NS dependencies the zone is part of
+	Glue       []GlueIssue     `json:"Glue,omitempty"`       // Problems with the glue in the delegation
+	DSMismatch []string        `json:"DSMismatch,omitempty"` // Supplied DS without a matching DNSKEY, see TestUndelegated
+	Diversity  *Diversity      `json:"Diversity,omitempty"`  // Network diversity of the servers
+	Instances  *Instances      `json:"Instances,omitempty"`  // Servers grouped by identity, see QueryIdentity
+	EDNS       []EdnsResult    `json:"EDNS,omitempty"`       // EDNS compliance of the servers, see QueryEDNS
+	UDPSize    []UDPSizeResult `json:"UDPSize,omitempty"`    // UDP size behaviour of the servers, see QueryUDPSize
+	Cookies    []CookieResult  `json:"Cookies,omitempty"`    // DNS Cookie support of the servers, see QueryCookies
+	Hints      []string        `json:"Hints,omitempty"`      // ROOT only. How the priming response differs from the hints
 }
 
 // ZoneNS
 //
 // Struct to hold relevant data for the Zones Authoritative nameservers
 type ZoneNS struct {
-	Self   int8     `json:"Self"` // Reference to index in the Zone struct NSIP list from where the data was received
-	NS     []int8   `json:"NS"`   // Reference to indexes in the Zone struct NSIP list containing NS record info
-	SOA    string   `json:"SOA"`
-	DNSKEY []string `json:"DNSKEY"`
-	RRSIG  []string `json:"RRSIG"`
+	Self   int8              `json:"Self"` // Reference to index in the Zone struct NSIP list from where the data was received
+	NS     []int8            `json:"NS"`   // Reference to indexes in the Zone struct NSIP list containing NS record info
+	SOA    string            `json:"SOA"`
+	DNSKEY []string          `json:"DNSKEY"`
+	RRSIG  []string          `json:"RRSIG"`
+	TTL    map[string]uint32 `json:"TTL,omitempty"`    // TTL per record type, see keepTTL
+	Source string            `json:"Source,omitempty"` // Set if the data is not from the server itself, see ImportZoneFile
 }
 
 // ParentNS
 //
 // Struct to hold relevant data from name servers of Parent zone
 type ParentNS struct {
-	Name        string   `json:"Name"`
-	IP          string   `json:"IP"`
-	NS          []int8   `json:"NS"` // Reference to indexes in the Zone struct NSIP list containing NS record info
-	DS          []string `json:"DS"`
-	RRSIG       []string `json:"RRSIG"`
-	ChildStatus int32    `json:"ChildStatus"` // Used to keep track of inconsitencies in delgation NS set @ parents
+	Name        string            `json:"Name"`
+	IP          string            `json:"IP"`
+	NS          []int8            `json:"NS"` // Reference to indexes in the Zone struct NSIP list containing NS record info
+	DS          []string          `json:"DS"`
+	RRSIG       []string          `json:"RRSIG"`
+	Glue        []string          `json:"Glue"`          // A/AAAA from the Additional section, as "name IP"
+	TTL         map[string]uint32 `json:"TTL,omitempty"` // TTL per record type, see keepTTL
+	ChildStatus int32             `json:"ChildStatus"`   // Used to keep track of inconsitencies in delgation NS set @ parents
 }
 
 // NSIP
 //
 // Struct to hold relevant NS / Delegation data
 type NSIP struct {
-	Name       string `json:"Name"`
-	IP         string `json:"IP"`
-	ZoneStatus int32  `json:"ZoneStatus"` // Status of the zone according to this server
+	Name       string    `json:"Name"`
+	IP         string    `json:"IP"`
+	ZoneStatus int32     `json:"ZoneStatus"`         // Status of the zone according to this server
+	Prefix     string    `json:"Prefix,omitempty"`   // Routed prefix of IP, from the ASN table
+	ASN        string    `json:"ASN,omitempty"`      // Origin AS(es) of Prefix, as in the table. See Origins
+	Identity   *Identity `json:"Identity,omitempty"` // What the server says about itself, see QueryIdentity
+	Resolved   bool      `json:"Resolved,omitempty"` // IP from a resolver, not from glue or the zone's servers. See checkCircular
 }
 
 // Server
@@ -76,7 +100,9 @@ type NSIP struct {
 // Struct used for keeping relevant information on nameservers (Resolvers and Authoritative)
 // in a global cache
 type Server struct {
-	IP []string `json:"IP"`
+	IP     []string             `json:"IP"`
+	RTT    map[string]ServerRTT `json:"RTT"`              // Smoothed RTT per IP
+	Cookie map[string]string    `json:"Cookie,omitempty"` // Last server cookie per IP, as hex
 }
 
 // GetNSIP
@@ -119,6 +145,42 @@ func (z *Zone) GetNSIP6() map[string]string {
 	return nsset
 }
 
+// expireIn
+//
+// Record that the zone data expires in ttl seconds, unless it already
+// expires sooner. Informational only, see Ready.
+func (z *Zone) expireIn(ttl uint32) {
+	exp := time.Now().Add(time.Duration(ttl) * time.Second)
+	if z.Expires.IsZero() || exp.Before(z.Expires) {
+		z.Expires = exp
+	}
+}
+
+// keepTTL
+//
+// Record the TTL of a record of type rtype, and return the new map.
+// The lowest TTL is kept, if the type is seen more than once. ttls is
+// copied, since cached copies of the zone may share it.
+func keepTTL(ttls map[string]uint32, rtype string, ttl uint32) map[string]uint32 {
+	if old, ok := ttls[rtype]; ok && old <= ttl {
+		return ttls
+	}
+	m := maps.Clone(ttls)
+	if m == nil {
+		m = make(map[string]uint32)
+	}
+	m[rtype] = ttl
+	return m
+}
+
+// Ready
+//
+// Check if the zone (or alias) is complete. Expires is not checked, the
+// cache is kept until it is rebuilt.
+func (z *Zone) Ready() bool {
+	return z.Status == 200 || z.Status == 301
+}
+
 // CalcZoneStatus
 //
 // Return the status of the zone as seen by the delegating parent.
@@ -137,6 +199,10 @@ func (z *Zone) CalcZoneStatus() int32 {
 		return 204
 	}
 
+	if _, ok := cs[301]; ok {
+		return 301
+	}
+
 	if _, ok := cs[403]; ok {
 		return 403
 	}
@@ -159,6 +225,14 @@ func (z *Zone) CalcZoneStatus() int32 {
 // 2. a globar Server cache with lookup info, mainly for batch use
 // Keeping them separate should help with r/w access.
 func BuildZoneCache(z string, cfg *Config) {
+	buildZoneCache(z, cfg, 0)
+}
+
+// buildZoneCache
+//
+// Does the work for BuildZoneCache. depth is the number of aliases
+// followed to get here, to stop on loops and overly long chains.
+func buildZoneCache(z string, cfg *Config, depth int) {
 
 	// If asked to check . (i.e. ROOT zone)
 	// do nothing, since the ROOT zone is already
@@ -166,9 +240,23 @@ func BuildZoneCache(z string, cfg *Config) {
 	if z == "." {
 		return
 	}
+
+	// Except when the ROOT has expired
+	if cfg.RootExpired() {
+		if err := cfg.PrimeRoot(); err != nil {
+			cfg.Log.Warn("Unable to prime ROOT. Using hints", "Error", err)
+		}
+	}
+	start := time.Now()
+	defer func() {
+		metrics.BuildDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	// Make DNS tree list to iterate through
 	list := dig.Path(z)
 
+	var alias Zone
+
 	// Loop through the nodes and perp the zone.
 	// Will start at TLD, because ROOT should already be primed.
 	for _, node := range list {
@@ -179,6 +267,24 @@ func BuildZoneCache(z string, cfg *Config) {
 			cfg.Log.Error("Error preparing zone", "zone", node, "Error", err)
 		}
 		cfg.Zones.Set(node, zone)
+		metrics.ObserveZone(zone.Status)
+
+		if zone.Status == 301 {
+			alias = zone
+		}
+	}
+
+	// Zones on the path that could not be (fully) resolved
+	for _, cut := range cfg.ZoneCutPath(list) {
+		cfg.checkCircular(cut, depth)
+	}
+
+	// Resolution of the name continues in another branch of the tree.
+	// Optionally build that one as well. Only the deepest alias matters,
+	// as that is where the name ends up.
+	if alias.Alias != "" && cfg.Opt.FollowAlias && depth < maxAliasChain {
+		cfg.Log.Debug("Following alias", "name", alias.Name, "type", alias.AliasRR, "target", alias.Alias)
+		buildZoneCache(alias.Alias, cfg, depth+1)
 	}
 
 	tree := cfg.ZoneCutPath(list)
@@ -225,12 +331,7 @@ func (c *Config) ZoneCutPath(list []string) []string {
 // Check if the name of the nameserver is a subdomain to the currently
 // queried domain. Relevant fpr finding glue.
 func DelegationInBailiwick(nsname, dom string) bool {
-	// make fqdn and compare the domain w the last part of NS name.
-	domain := dns.Fqdn(nsname[len(nsname)-len(dom):])
-	if domain == nsname {
-		return true
-	}
-	return false
+	return dns.IsSubDomain(dns.Fqdn(dom), dns.Fqdn(nsname))
 }
 
 // ToJson
@@ -249,23 +350,6 @@ func (z Zone) ToPrettyJson() (string, error) {
 	return string(jz), err
 }
 
-// Preload
-// Bootstrap the cache with ROOT-zone data from root-hints json file
-// Can be used for other prepared hint files. Zones dumped to json should
-// import with no hassle.
-func (z *Zone) Preload(file string) {
-
-	js, err := os.ReadFile("hints/" + file)
-	if err != nil {
-		fmt.Printf("Warning: unable to load hint file %s (%s)\n", file, err.Error())
-	}
-	json.Unmarshal(js, z)
-	if err != nil {
-		fmt.Printf("Warning: unable to unmarshal(%s)\n", err.Error())
-	}
-
-}
-
 func NewZoneCache() Map[Zone] {
 	return NewMapFromConfig[Zone](false) // set true for dummy
 }
@@ -280,7 +364,7 @@ func NewServerCache() Map[Server] {
 // func (z *Zone) QueryParentForDelegation(nslist map[string]string, cfg *Config) error {
 func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 
-	q := dig.NewQuery()
+	q := cfg.NewQuery()
 	q.Qname = z.Name
 	q.Qtype = "SOA" // query for SOA and set DO (qmin-ish and may save a query or two)
 	q.DO = true
@@ -309,7 +393,7 @@ func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 
 	q.Nameserver = ip
 	cfg.Log.Debug("Parent Query:", "query", q)
-	msg, err := dig.GetDelegation(q, cfg.Log)
+	msg, err := cfg.Query(q, name)
 	if err != nil {
 		//cfg.Log.Error("DELEGATION: Error looking up domain", "domain", err.Error())
 		cfg.Log.Debug("Query Failed Trying next nameserver in list", "ERROR", err)
@@ -320,6 +404,17 @@ func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 
 		cfg.Log.Debug("DELEGATION: NOERROR", "QNAME", q.Qname, "server", q.Nameserver)
 
+		// A CNAME (or DNAME above the name) in the Answer section
+		// means the name is an alias, not a zone
+		if rtype, target, ttl := findAlias(z.Name, msg.Answer); target != "" {
+			cfg.Log.Debug("[Parent] reported [Name] to be an alias for [Target]", "Parent", q.Nameserver, "Name", q.Qname, "Type", rtype, "Target", target)
+			z.ParentNS[pid].ChildStatus = 301
+			z.Alias = target
+			z.AliasRR = rtype
+			z.expireIn(ttl)
+			return 301
+		}
+
 		// Get info from Auth section
 		// Extract DNSSEC info, if any, and make a list of delegation
 		// Name Servers
@@ -329,6 +424,13 @@ func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 			// RDATA is in dns.RR.<section>[1:]
 			switch au.Rtype {
 			case "NS":
+				z.expireIn(au.Ttl)
+				z.ParentNS[pid].TTL = keepTTL(z.ParentNS[pid].TTL, au.Rtype, au.Ttl)
+				// A referral is a zone cut, even if no child server
+				// can be found to confirm it
+				if strings.EqualFold(au.Name, z.Name) {
+					z.ZoneCut = z.Name
+				}
 				// create placeholder NS struct to put IP in later
 				name := au.GetRdata()
 				// Check if the name is already in the NSIP list of the zone
@@ -344,8 +446,10 @@ func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 				//z.ParentNS[pid].ChildStatus = 200
 			case "DS":
 				z.ParentNS[pid].DS = append(z.ParentNS[pid].DS, au.GetRdata())
+				z.ParentNS[pid].TTL = keepTTL(z.ParentNS[pid].TTL, au.Rtype, au.Ttl)
 			case "RRSIG":
 				z.ParentNS[pid].RRSIG = append(z.ParentNS[pid].RRSIG, au.GetRdata())
+				z.ParentNS[pid].TTL = keepTTL(z.ParentNS[pid].TTL, au.Rtype, au.Ttl)
 			case "SOA":
 				// NORROR + Authoritative answer + SOA in Authoritative section
 				// indicates that name in either a host name or an empty non-terminal
@@ -362,8 +466,16 @@ func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 
 		// Get all glue that is provided, but dont trust it to be complete.
 		// This will save a few lookups further on
+		// Glue for names not in the NS set is kept for the glue analysis
+		// (see AnalyzeGlue), but not used.
 		for _, e := range msg.Additional {
 			if e.Rtype == "A" || e.Rtype == "AAAA" {
+				z.ParentNS[pid].Glue = append(z.ParentNS[pid].Glue, glueEntry(e.Name, e.GetRdata()))
+				z.ParentNS[pid].TTL = keepTTL(z.ParentNS[pid].TTL, e.Rtype, e.Ttl)
+				if !slices.ContainsFunc(delegns, func(ns NSIP) bool { return strings.EqualFold(ns.Name, e.Name) }) {
+					cfg.Log.Debug("DELEGATION: Glue for name not in NS set", "Name", e.Name, "IP", e.GetRdata())
+					continue
+				}
 				// check if an identical entry exists
 				id := slices.IndexFunc(delegns, func(ns NSIP) bool {
 					return ns.IP == e.GetRdata() && ns.Name == e.Name
@@ -424,16 +536,24 @@ func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 					}
 				}
 
+				resolved := false
 				if len(iplist) < 1 {
 					cfg.Log.Debug("DELEGATION: Nameserver NOT in global cache. Querying resolver.", "Name", e.Name)
 					// Cheat and use a resolver to get the IP(s) for the NS name
-					iplist, _ = dig.QndQuery(e.Name, cfg.GetResolver(), cfg.Log)
+					iplist, _ = cfg.Resolve(e.Name)
 					if len(iplist) > 0 {
-						server := Server{IP: iplist}
-						cfg.Cache.Set(e.Name, server)
+						cfg.Log.Debug("DELEGATION: Nameserver address from resolver", "Name", e.Name, "IP", iplist)
+						cfg.SetServerIP(e.Name, iplist)
+						resolved = true
 					}
 				}
 
+				// Keep the name, to be able to tell why later on
+				if len(iplist) < 1 {
+					cfg.Log.Debug("DELEGATION: No IP found for nameserver", "Name", e.Name)
+					z.ParentNS[pid].NS = append(z.ParentNS[pid].NS, z.addNSIP(e.Name, ""))
+				}
+
 				for _, ip := range iplist {
 					// Even if the IP was not in the Glue for this NS
 					// it might have been added when processing another
@@ -453,6 +573,9 @@ func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 						})
 						cfg.Log.Debug("DELEGATION: ns <-> ip pair (still) not in list. Adding new entry", "NSIP", nsip, "Index", id)
 					}
+					if resolved {
+						z.NSIP[id].Resolved = true
+					}
 					z.ParentNS[pid].NS = append(z.ParentNS[pid].NS, int8(id))
 				}
 			}
@@ -514,17 +637,25 @@ func (z *Zone) QueryParentForDelegation(ip, name string, cfg *Config) int32 {
 // to complete the list of nameservers (if needed) and add references to them-
 func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 
-	q := dig.NewQuery()
+	q := cfg.NewQuery()
 	q.Qname = z.Name
 	// query for SOA and set DO (qmin-ish and may save a query or two)
 	q.Qtype = "NS"
 	q.DO = true
 
 	// full set should be in z.NSID
-	for i, nsip := range z.NSIP {
+	// Go through the servers fastest first (see OrderByRTT)
+	for _, i := range cfg.orderNSIP(z.NSIP) {
+		nsip := z.NSIP[i]
 
 		cfg.Log.Debug("Querying server", "nr", i+1, "of", len(z.NSIP), "in list", nsip)
 
+		// Name without address. Nothing to query
+		if nsip.IP == "" {
+			z.NSIP[i].ZoneStatus = 508
+			continue
+		}
+
 		// Dont query IP-addresses of the wrong version if the option to
 		// use only 4 or 6 is set.
 		if cfg.Opt.IPv4only && strings.Contains(nsip.IP, ":") {
@@ -533,7 +664,7 @@ func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 			continue
 		}
 
-		if cfg.IPv6only && !strings.Contains(nsip.IP, ":") {
+		if cfg.Opt.IPv6only && !strings.Contains(nsip.IP, ":") {
 			cfg.Log.Debug("IPv6 only. Ignoring address).", "IP", nsip.IP)
 			z.NSIP[i].ZoneStatus = 422 // won't do the v4 for conf reasons
 			continue
@@ -542,7 +673,7 @@ func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 		q.Nameserver = nsip.IP
 
 		cfg.Log.Debug("SELF Query:", "query", q)
-		msg, err := dig.GetDelegation(q, cfg.Log)
+		msg, err := cfg.Query(q, nsip.Name)
 		if err != nil {
 			z.NSIP[i].ZoneStatus = 500
 			cfg.Log.Debug("Query Failed Trying next nameserver in list", "ERROR", err)
@@ -578,6 +709,14 @@ func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 				// Only log this 4 now
 			}
 
+			// An alias at (what should be) the apex is broken.
+			// Don't mistake the CNAME for a zone cut
+			if rtype, target, _ := findAlias(z.Name, msg.Answer); target != "" {
+				cfg.Log.Debug("Got alias in reply to NS query", "QNAME", q.Qname, "server", q.Nameserver, "Type", rtype, "Target", target)
+				z.NSIP[i].ZoneStatus = 301
+				continue
+			}
+
 			var zns ZoneNS
 
 			// nameservers in NS section
@@ -587,13 +726,14 @@ func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 			for _, an := range msg.Answer {
 
 				// RDATA is in dns.RR.<section>[1:]
-				if an.Rtype == "NS" {
+				if an.Rtype == "NS" && strings.EqualFold(an.Name, z.Name) {
 					nsrr = append(nsrr, an.GetRdata())
+					zns.TTL = keepTTL(zns.TTL, an.Rtype, an.Ttl)
 				}
 			}
 
 			// check if Zone cut is current zone
-			if len(msg.Answer) > 0 {
+			if len(nsrr) > 0 {
 				cfg.Log.Debug("Zone Cut", "@", z.Name)
 				z.ZoneCut = z.Name
 			}
@@ -649,7 +789,7 @@ func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 
 				if DelegationInBailiwick(name, z.Name) {
 					cfg.Log.Debug("Making Biliwick Lookup", "Name", name)
-					iplist, err = dig.QndQuery(name, nsip.IP, cfg.Log)
+					iplist, err = cfg.LookupAt(name, nsip.IP)
 				}
 				if err != nil {
 					cfg.Log.Error("Error in Biliwick Lookup", "ERR", err)
@@ -670,15 +810,20 @@ func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 
 				// If that fails, use a resolver to get the IP(s) for
 				// the NS name
+				resolved := false
 				if len(iplist) < 1 {
 					cfg.Log.Debug("Making Resolver Lookup", "Name", name)
-					iplist, _ = dig.QndQuery(name, cfg.GetResolver(), cfg.Log)
+					iplist, _ = cfg.Resolve(name)
 					// if this succeeds, save server in global cache
 					if len(iplist) > 0 {
-						server := Server{IP: iplist}
-						cfg.Cache.Set(name, server)
+						cfg.SetServerIP(name, iplist)
+						resolved = true
 					}
 				}
+				if len(iplist) < 1 {
+					cfg.Log.Debug("No IP found for nameserver", "Name", name)
+					zns.NS = append(zns.NS, z.addNSIP(name, ""))
+				}
 				for _, ip := range iplist {
 					// Even if the IP was not in the Glue for this NS
 					// it might have been added when processing another
@@ -699,6 +844,9 @@ func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 						cfg.Log.Debug("ns <-> ip pair (still) not in list. Adding new entry", "NSIP", nsip, "Index", id)
 					}
 
+					if resolved {
+						z.NSIP[id].Resolved = true
+					}
 					// Add the id as a NSID reference in the ZoneNS.
 					cfg.Log.Debug("Adding reference to NS list", "ID", id)
 					zns.NS = append(zns.NS, int8(id))
@@ -717,6 +865,11 @@ func (z *Zone) QuerySelfForNS(cfg *Config, QminFirstPath bool) error {
 			// to OK
 			z.Status = 200
 
+			// Collect the rest of the apex data, if asked to
+			if cfg.Opt.QueryApex {
+				z.queryApex(nsip, &zns, cfg)
+			}
+
 			// Sort the NS list for easier comparison later
 			slices.Sort(zns.NS)
 			// Add the ZonNS to the Zone
@@ -768,3 +921,40 @@ func ToFQDN(name string) string {
 func DigPath(dom string) []string {
 	return dig.Path(dom)
 }
+
+// queryApex
+//
+// Get SOA and DNSKEY (with signatures) for the zone from one of its
+// authoritative servers, and add them to the ZoneNS of that server.
+func (z *Zone) queryApex(nsip NSIP, zns *ZoneNS, cfg *Config) {
+
+	q := cfg.NewQuery()
+	q.Qname = z.Name
+	q.Nameserver = nsip.IP
+	q.DO = true
+
+	for _, qtype := range []string{"SOA", "DNSKEY"} {
+		q.Qtype = qtype
+		msg, err := cfg.Query(q, nsip.Name)
+		if err != nil || msg.Rcode != "NOERROR" || !msg.AA {
+			cfg.Log.Debug("APEX: No usable answer", "Zone", z.Name, "Qtype", qtype, "Server", nsip.IP, "Rcode", msg.Rcode)
+			continue
+		}
+		for _, an := range msg.Answer {
+			if !strings.EqualFold(an.Name, z.Name) {
+				continue
+			}
+			switch an.Rtype {
+			case "SOA":
+				zns.SOA = an.GetRdata()
+			case "DNSKEY":
+				zns.DNSKEY = append(zns.DNSKEY, an.GetRdata())
+			case "RRSIG":
+				zns.RRSIG = append(zns.RRSIG, an.GetRdata())
+			default:
+				continue
+			}
+			zns.TTL = keepTTL(zns.TTL, an.Rtype, an.Ttl)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Zone files that can be imported from the hints directory
+var zoneFileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// delegation
+//
+// What a parent zone file publishes for one child zone
+type delegation struct {
+	ns []string
+	ds []string
+}
+
+// ImportZoneFile
+//
+// Seed the Zone cache with the delegations found in an RFC 1035 master
+// file for origin (e.g. a TLD zone file from CZDS). For every delegation
+// point a Zone is created with one ParentNS entry holding the NS, glue
+// and DS records published in the file. Name is set to source, and IP
+// is left empty, to show that the data did not come from a live server.
+//
+// Nothing has been asked of the zone's own servers, so the ZoneNS
+// entries (one per server with glue) are made up from the delegation,
+// and marked with Source. That is enough for GetNSIP and Nameservers
+// to use the servers, and for the glue to be checked right away.
+//
+// The zones get status 206 (incomplete), so a later build will still
+// query the live servers, keeping the imported delegation if a live
+// parent server publishes the same NS set (see keepImported). Zones
+// already in cache with status 200 are left as they are. Records outside
+// origin are skipped, the file can't speak for them. Returns the number
+// of zones imported.
+func (c *Config) ImportZoneFile(r io.Reader, origin, source string) (int, error) {
+
+	origin = ToFQDN(dns.CanonicalName(origin))
+
+	delegs := make(map[string]*delegation)
+	addrs := make(map[string][]string)
+
+	skipped := 0
+	zp := dns.NewZoneParser(r, origin, source)
+	zp.SetIncludeAllowed(false)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := dns.CanonicalName(rr.Header().Name)
+		if !dns.IsSubDomain(origin, owner) {
+			skipped++
+			continue
+		}
+		switch t := rr.(type) {
+		case *dns.NS:
+			// NS at the apex is the zone itself, not a delegation
+			if owner == origin {
+				continue
+			}
+			d := getDelegation(delegs, owner)
+			ns := dns.CanonicalName(t.Ns)
+			if !slices.Contains(d.ns, ns) {
+				d.ns = append(d.ns, ns)
+			}
+		case *dns.DS:
+			d := getDelegation(delegs, owner)
+			d.ds = append(d.ds, rdata(t))
+		case *dns.A:
+			addrs[owner] = append(addrs[owner], t.A.String())
+		case *dns.AAAA:
+			addrs[owner] = append(addrs[owner], t.AAAA.String())
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", source, err)
+	}
+
+	count := 0
+	for name, d := range delegs {
+		// DS without NS is not a delegation
+		if len(d.ns) < 1 {
+			continue
+		}
+		// Don't overwrite live data
+		if z, ok := c.Zones.Get(name); ok && z.Status == 200 {
+			continue
+		}
+
+		var zone Zone
+		zone.Name = name
+		zone.ZoneCut = name // A delegation is by definition a zone cut
+		zone.Status = 206
+
+		parent := ParentNS{
+			Name:        source,
+			DS:          d.ds,
+			ChildStatus: 200,
+		}
+		for _, ns := range d.ns {
+			for _, ip := range addrs[ns] {
+				parent.NS = append(parent.NS, zone.addNSIP(ns, ip))
+				parent.Glue = append(parent.Glue, glueEntry(ns, ip))
+			}
+			// Keep out of bailiwick names without glue as well
+			if len(addrs[ns]) < 1 {
+				parent.NS = append(parent.NS, zone.addNSIP(ns, ""))
+			}
+		}
+		slices.Sort(parent.NS)
+		zone.ParentNS = append(zone.ParentNS, parent)
+
+		for _, id := range parent.NS {
+			if zone.NSIP[id].IP != "" {
+				zone.ZoneNS = append(zone.ZoneNS, ZoneNS{Self: id, NS: parent.NS, Source: source})
+			}
+		}
+		zone.Glue = zone.AnalyzeGlue(origin)
+
+		c.Zones.Set(name, zone)
+		count++
+	}
+
+	c.Log.Info("Imported zone file", "source", source, "origin", origin, "zones", count, "skipped", skipped)
+
+	return count, nil
+}
+
+// imported
+//
+// Check if the delegation came from a zone file, see ImportZoneFile.
+func (p ParentNS) imported() bool {
+	return p.IP == "" && p.Name != UndelegatedParent
+}
+
+// keepImported
+//
+// Carry the imported delegations of old (see ImportZoneFile) over to z,
+// a fresh build of the same zone, if a live parent server publishes the
+// same NS set. Other imported data, like the made up ZoneNS, is replaced
+// by what the build found.
+func (z *Zone) keepImported(old Zone) {
+	live := make(map[string]bool)
+	for _, p := range z.ParentNS {
+		if p.ChildStatus == 200 && p.IP != "" {
+			live[strings.ToLower(strings.Join(z.nsNames(p.NS), " "))] = true
+		}
+	}
+
+	for _, p := range old.ParentNS {
+		if !p.imported() || !live[strings.ToLower(strings.Join(old.nsNames(p.NS), " "))] {
+			continue
+		}
+		var ids []int8
+		for _, id := range p.NS {
+			ns := old.nsip(id)
+			// No glue in the file. Use the addresses the build found
+			if ns.IP == "" {
+				if found := z.nsipByName(ns.Name); len(found) > 0 {
+					ids = append(ids, found...)
+					continue
+				}
+			}
+			ids = append(ids, z.addNSIP(ns.Name, ns.IP))
+		}
+		slices.Sort(ids)
+		p.NS = slices.Compact(ids)
+		z.ParentNS = append(z.ParentNS, p)
+	}
+}
+
+// nsipByName
+//
+// Get the indexes of the NSIP entries of name that have an address
+func (z *Zone) nsipByName(name string) []int8 {
+	var ids []int8
+	for i, ns := range z.NSIP {
+		if strings.EqualFold(ns.Name, name) && ns.IP != "" {
+			ids = append(ids, int8(i))
+		}
+	}
+	return ids
+}
+
+func getDelegation(delegs map[string]*delegation, name string) *delegation {
+	if d, ok := delegs[name]; ok {
+		return d
+	}
+	d := &delegation{}
+	delegs[name] = d
+	return d
+}
+
+// rdata
+//
+// Get the RDATA of a record as one (1) space separated string,
+// the same way dig.DigRR.GetRdata does it.
+func rdata(rr dns.RR) string {
+	var f []string
+	for i := 1; i <= dns.NumField(rr); i++ {
+		f = append(f, dns.Field(rr, i))
+	}
+	return strings.Join(f, " ")
+}
+
+// ImportHintZoneFile
+//
+// Same as ImportZoneFile, but for a file in the hints directory.
+func (c *Config) ImportHintZoneFile(file, origin string) (int, error) {
+	if !zoneFileName.MatchString(file) {
+		return 0, fmt.Errorf("invalid zone file name %q", file)
+	}
+	f, err := os.Open(filepath.Join("hints", file))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return c.ImportZoneFile(f, origin, file)
+}
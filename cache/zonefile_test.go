@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"zonetree/logger"
+)
+
+const testZoneFile = `$ORIGIN se.
+$TTL 3600
+@		IN SOA	ns.se. hostmaster.se. 1 3600 600 86400 300
+@		IN NS	ns.se.
+ns		IN A	192.0.2.53
+example		IN NS	ns1.example
+example		IN NS	ns.other.net.
+ns1.example	IN A	192.0.2.1
+ns1.example	IN AAAA	2001:db8::1
+example		IN DS	12345 13 2 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+signed		IN DS	54321 13 2 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+live		IN NS	ns.live.net.
+outside.com.	IN NS	ns.outside.com.
+ns.other.net.	IN A	198.51.100.1
+`
+
+func TestImportZoneFile(t *testing.T) {
+	cfg := &Config{Log: logger.DummyLogger{}, Zones: NewZoneCache(), Cache: NewServerCache()}
+	cfg.Zones.Set("live.se.", Zone{Name: "live.se.", Status: 200})
+
+	n, err := cfg.ImportZoneFile(strings.NewReader(testZoneFile), "se", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("imported %d zones, want 1", n)
+	}
+
+	tests := []struct {
+		zone   string
+		found  bool
+		status int32
+		nsip   []string // name IP
+		glue   []string
+		ds     int
+	}{
+		{"example.se.", true, 206,
+			[]string{"ns1.example.se. 192.0.2.1", "ns1.example.se. 2001:db8::1", "ns.other.net. "},
+			[]string{"ns1.example.se. 192.0.2.1", "ns1.example.se. 2001:db8::1"}, 1},
+		{"live.se.", true, 200, nil, nil, 0},    // Live data is kept
+		{"signed.se.", false, 0, nil, nil, 0},   // DS without NS
+		{"outside.com.", false, 0, nil, nil, 0}, // Outside origin
+		{"se.", false, 0, nil, nil, 0},          // Apex
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			z, ok := cfg.Zones.Get(tt.zone)
+			if ok != tt.found {
+				t.Fatalf("found = %v, want %v", ok, tt.found)
+			}
+			if !ok {
+				return
+			}
+			if z.Status != tt.status {
+				t.Errorf("Status = %d, want %d", z.Status, tt.status)
+			}
+			var nsip []string
+			for _, ns := range z.NSIP {
+				nsip = append(nsip, ns.Name+" "+ns.IP)
+			}
+			if !slices.Equal(nsip, tt.nsip) {
+				t.Errorf("NSIP = %q, want %q", nsip, tt.nsip)
+			}
+			if tt.status != 206 {
+				return
+			}
+			if len(z.ParentNS) != 1 || z.ParentNS[0].Name != "test" {
+				t.Fatalf("ParentNS = %+v", z.ParentNS)
+			}
+			// One made up ZoneNS per server with glue, so GetNSIP has them
+			for _, zns := range z.ZoneNS {
+				if zns.Source != "test" {
+					t.Errorf("ZoneNS Source = %q, want test", zns.Source)
+				}
+			}
+			if len(z.ZoneNS) != len(tt.glue) || len(z.GetNSIP()) != len(tt.glue) {
+				t.Errorf("%d ZoneNS, %d GetNSIP, want %d", len(z.ZoneNS), len(z.GetNSIP()), len(tt.glue))
+			}
+			// The glue is in documentation ranges
+			if !slices.ContainsFunc(z.Glue, func(g GlueIssue) bool { return g.Issue == GlueBogon }) {
+				t.Errorf("Glue = %+v, want bogon issues", z.Glue)
+			}
+			if !slices.Equal(z.ParentNS[0].Glue, tt.glue) {
+				t.Errorf("Glue = %q, want %q", z.ParentNS[0].Glue, tt.glue)
+			}
+			if len(z.ParentNS[0].DS) != tt.ds {
+				t.Errorf("%d DS, want %d", len(z.ParentNS[0].DS), tt.ds)
+			}
+		})
+	}
+}
+
+func TestImportKeptByBuild(t *testing.T) {
+	// se. at 127.0.0.1 delegates example.se. to ns1.example.se. at 127.0.0.2
+	handler := func(ip string, q dns.Question) testAnswer {
+		switch {
+		case ip == "127.0.0.1" && q.Name == "example.se.":
+			return testAnswer{
+				Ns:    []string{"example.se. 3600 IN NS ns1.example.se."},
+				Extra: []string{"ns1.example.se. 3600 IN A 127.0.0.2"},
+			}
+		case ip == "127.0.0.2" && q.Name == "example.se." && q.Qtype == dns.TypeNS:
+			return testAnswer{AA: true,
+				Answer: []string{"example.se. 3600 IN NS ns1.example.se."},
+				Extra:  []string{"ns1.example.se. 3600 IN A 127.0.0.2"},
+			}
+		}
+		return testAnswer{Rcode: dns.RcodeNameError}
+	}
+
+	tests := []struct {
+		name string
+		file string
+		kept bool
+	}{
+		{"confirmed", "example IN NS ns1.example\nns1.example IN A 127.0.0.2\nexample IN DS 1 13 2 00ff\n", true},
+		{"other ns", "example IN NS ns9.example\nns9.example IN A 127.0.0.9\nexample IN DS 1 13 2 00ff\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, handler, "127.0.0.1", "127.0.0.2")
+			cfg.Zones.Set("se.", Zone{Name: "se.", ZoneCut: "se.", Status: 200,
+				NSIP: []NSIP{{Name: "ns.se.", IP: "127.0.0.1"}}, ZoneNS: []ZoneNS{{Self: 0, NS: []int8{0}}}})
+
+			if _, err := cfg.ImportZoneFile(strings.NewReader(tt.file), "se.", "test"); err != nil {
+				t.Fatal(err)
+			}
+			BuildZoneCache("example.se.", cfg)
+
+			z, _ := cfg.Zones.Get("example.se.")
+			if z.Status != 200 {
+				t.Fatalf("Status = %d, want 200", z.Status)
+			}
+			for _, zns := range z.ZoneNS {
+				if zns.Source != "" {
+					t.Errorf("made up ZoneNS %+v left after build", zns)
+				}
+			}
+			i := slices.IndexFunc(z.ParentNS, func(p ParentNS) bool { return p.imported() })
+			if (i >= 0) != tt.kept {
+				t.Fatalf("imported delegation kept = %v, want %v: %+v", i >= 0, tt.kept, z.ParentNS)
+			}
+			if i < 0 {
+				return
+			}
+			p := z.ParentNS[i]
+			if p.Name != "test" || len(p.DS) != 1 || !slices.Equal(z.nsNames(p.NS), []string{"ns1.example.se."}) {
+				t.Errorf("imported delegation = %+v", p)
+			}
+			if !slices.ContainsFunc(z.Glue, func(g GlueIssue) bool { return slices.Contains(g.Servers, "test") }) {
+				t.Errorf("Glue = %+v, want the imported glue checked", z.Glue)
+			}
+		})
+	}
+}
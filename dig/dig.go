@@ -2,17 +2,40 @@ package dig
 
 import (
 	//"fmt"
+	"encoding/hex"
+	"errors"
 	"log"
 	"strconv"
 	"strings"
 	"time"
+	"zonetree/metrics"
 
 	"github.com/miekg/dns"
 )
 
+// Default timing used when a query does not carry its own
+const (
+	DefaultTimeout = 2 * time.Second
+	DefaultBackoff = 250 * time.Millisecond
+)
+
 // func Dig(query Query) (DigOut, error) {
 func Dig(query Query) (dns.Msg, error) {
 
+	out, err := Exchange(query)
+
+	//return *response, err
+	return *out.Response, err
+}
+
+// Exchange
+//
+// Send the query and return the response together with RTT, message size
+// and the query itself. A query that gets no response is retried
+// query.Retries times, waiting query.Backoff (doubled for each attempt)
+// between the attempts.
+func Exchange(query Query) (DigOut, error) {
+
 	// Just to be safe, we sanitize data close to usage
 	query.Sanitize()
 
@@ -33,50 +56,79 @@ func Dig(query Query) (dns.Msg, error) {
 	message.Question[0] = dns.Question{
 		Name:   dns.Fqdn(query.Qname),
 		Qtype:  TypeToInt(query.Qtype),
-		Qclass: dns.ClassINET,
+		Qclass: ClassToInt(query.Qclass),
 	}
 
-	o := &dns.OPT{
-		Hdr: dns.RR_Header{
-			Name:   ".",
-			Rrtype: dns.TypeOPT,
-		},
-	}
+	if !query.NoEdns {
+		o := &dns.OPT{
+			Hdr: dns.RR_Header{
+				Name:   ".",
+				Rrtype: dns.TypeOPT,
+			},
+		}
 
-	o.SetUDPSize(query.UDPsize) // other options may override. Change later?
+		o.SetUDPSize(query.UDPsize) // other options may override, unless FixedUDPsize is set
+		o.SetVersion(query.EdnsVersion)
+		o.SetZ(query.EdnsFlags)
 
-	if query.DO {
-		o.SetDo()
-		o.SetUDPSize(dns.DefaultMsgSize)
-	}
-	if query.Nsid {
-		e := &dns.EDNS0_NSID{
-			Code: dns.EDNS0NSID,
+		if query.DO {
+			o.SetDo()
+			if !query.FixedUDPsize {
+				o.SetUDPSize(dns.DefaultMsgSize)
+			}
 		}
-		o.Option = append(o.Option, e)
-		// NSD will not return nsid when the udp message size is too small
-		o.SetUDPSize(dns.DefaultMsgSize)
+		if query.Nsid {
+			e := &dns.EDNS0_NSID{
+				Code: dns.EDNS0NSID,
+			}
+			o.Option = append(o.Option, e)
+			// NSD will not return nsid when the udp message size is too small
+			if !query.FixedUDPsize {
+				o.SetUDPSize(dns.DefaultMsgSize)
+			}
+		}
+		if query.Cookie != "" {
+			e := &dns.EDNS0_COOKIE{
+				Code:   dns.EDNS0COOKIE,
+				Cookie: query.Cookie,
+			}
+			o.Option = append(o.Option, e)
+		}
+		if query.EdnsOpt != "" {
+			if e, err := ParseEdnsOpt(query.EdnsOpt); err == nil {
+				o.Option = append(o.Option, e)
+			} else {
+				log.Print("EDNS option error: ", err)
+			}
+		}
+		message.Extra = append(message.Extra, o)
 	}
-	message.Extra = append(message.Extra, o)
 
 	// Preserve name server name to use in output. Blank = system resolver
-	/*
-		QNS := "System Resolver"
-		if len(query.Nameserver) > 1 {
-			QNS = query.Nameserver
-		}
-	*/
+	QNS := "System Resolver"
+	if len(query.Nameserver) > 1 {
+		QNS = query.Nameserver
+	}
 	nameserver := query.GetLookupNS()
 
 	// Set correct transport protocol (udp, udp4, udp6, tcp, tcp4, tcp6)
 	query.Transport += query.IpVersion
 
+	timeout := query.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	backoff := query.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+
 	client := new(dns.Client)
 	client.Net = query.Transport
 
-	client.DialTimeout = 2 * time.Second
-	client.ReadTimeout = 2 * time.Second
-	client.WriteTimeout = 2 * time.Second
+	client.DialTimeout = timeout
+	client.ReadTimeout = timeout
+	client.WriteTimeout = timeout
 
 	if query.Tsig != "" {
 		if algo, name, secret, ok := tsigKeyParse(query.Tsig); ok {
@@ -88,14 +140,41 @@ func Dig(query Query) (dns.Msg, error) {
 		}
 	}
 
-	//response, rtt, err := client.Exchange(message, nameserver)
-	response, _, err := client.Exchange(message, nameserver)
+	var response *dns.Msg
+	var rtt time.Duration
+	var err error
+	attempts := 0
+
+	for attempt := 0; attempt <= query.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff << (attempt - 1))
+		}
+		attempts++
+		response, rtt, err = client.Exchange(message, nameserver)
+		if err == nil {
+			metrics.ObserveQuery(query.Transport, dns.RcodeToString[response.Rcode], rtt, nil)
+			break
+		}
+		metrics.ObserveQuery(query.Transport, "", rtt, err)
+	}
+
+	// Like dig, retry truncated responses over TCP, if asked to.
+	// If TCP fails, the truncated UDP response is still a response
+	if err == nil && response.Truncated && query.TCPFallback && !strings.HasPrefix(query.Transport, "tcp") {
+		tcp := *client
+		tcp.Net = "tcp" + query.IpVersion
+		attempts++
+		tcpResponse, tcpRTT, tcpErr := tcp.Exchange(message, nameserver)
+		if tcpErr == nil {
+			metrics.ObserveQuery(tcp.Net, dns.RcodeToString[tcpResponse.Rcode], tcpRTT, nil)
+			response, rtt = tcpResponse, tcpRTT
+			query.Transport = tcp.Net
+		} else {
+			metrics.ObserveQuery(tcp.Net, "", tcpRTT, tcpErr)
+		}
+	}
 
 	if err != nil {
-		// we panic here for now
-		/*
-			panic(err)
-		*/
 		// Craft a placeholder responde here instead of panicking,
 		// just to avoid nil pointer reference.
 		response = &dns.Msg{
@@ -107,29 +186,27 @@ func Dig(query Query) (dns.Msg, error) {
 		}
 	}
 
-	/*
-		msgSize := response.Len()
-
-		digOut := DigOut{
-			Qname:      query.Qname,
-			Query:      message, // Useful for the +qr option
-			Response:   response,
-			RTT:        rtt, // Note to self: rtt is in nanoseconds (1M ns = 1 millisecond)
-			Nameserver: nameserver,
-			QNSname:    QNS,
-			ShowQuery:  query.ShowQuery, // Useful for the +qr option
-			MsgSize:    msgSize,
-			Transport:  query.Transport,
-		}
-
-	*/
-
 	if query.NoCrypto {
 		nocryptoMsg(response)
 	}
 
-	//return *response, err
-	return *response, err
+	digOut := DigOut{
+		Qname:      query.Qname,
+		Query:      message, // Useful for the +qr option
+		Response:   response,
+		RTT:        rtt, // Note to self: rtt is in nanoseconds (1M ns = 1 millisecond)
+		Nameserver: nameserver,
+		QNSname:    QNS,
+		ShowQuery:  query.ShowQuery, // Useful for the +qr option
+		MsgSize:    response.Len(),
+		Transport:  query.Transport,
+		Attempts:   attempts,
+	}
+	if err != nil {
+		digOut.Error = err.Error()
+	}
+
+	return digOut, err
 }
 
 // emulate the dig option +nocrypto
@@ -178,6 +255,83 @@ func TypeToInt(t string) uint16 {
 	return ti
 }
 
+// ClassToInt
+//
+// Get the class number of c, e.g. CH for CHAOS. IN if c is empty,
+// zero if c is unknown.
+func ClassToInt(c string) uint16 {
+	if c == "" {
+		return dns.ClassINET
+	}
+	if strings.HasPrefix(c, "CLASS") {
+		if i, err := strconv.Atoi(c[5:]); err == nil {
+			return uint16(i)
+		}
+		return 0
+	}
+	return dns.StringToClass[strings.ToUpper(c)]
+}
+
+// ParseEdnsOpt
+//
+// Parse an EDNS option given as code[:hex data], e.g. 100 or 65001:beef
+func ParseEdnsOpt(s string) (*dns.EDNS0_LOCAL, error) {
+	c, data, _ := strings.Cut(s, ":")
+	code, err := strconv.ParseUint(c, 10, 16)
+	if err != nil {
+		return nil, errors.New("not an option code: " + c)
+	}
+	b, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, errors.New("option data is not hex: " + data)
+	}
+	return &dns.EDNS0_LOCAL{Code: uint16(code), Data: b}, nil
+}
+
+// Cookie
+//
+// Get the DNS Cookie option from the OPT record of msg, as hex.
+func Cookie(msg *dns.Msg) string {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_COOKIE); ok {
+			return e.Cookie
+		}
+	}
+	return ""
+}
+
+// NSID
+//
+// Get the NSID from the OPT record of msg. Printable NSIDs are
+// returned as text, anything else as hex.
+func NSID(msg *dns.Msg) string {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		e, ok := o.(*dns.EDNS0_NSID)
+		if !ok {
+			continue
+		}
+		b, err := hex.DecodeString(e.Nsid)
+		if err != nil {
+			return e.Nsid
+		}
+		for _, c := range b {
+			if c < 0x20 || c > 0x7e {
+				return e.Nsid
+			}
+		}
+		return string(b)
+	}
+	return ""
+}
+
 func tsigKeyParse(s string) (algo, name, secret string, ok bool) {
 	s1 := strings.SplitN(s, ":", 3)
 	switch len(s1) {
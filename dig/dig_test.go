@@ -0,0 +1,97 @@
+package dig
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestClassToInt(t *testing.T) {
+	tests := []struct {
+		class string
+		want  uint16
+	}{
+		{"", dns.ClassINET},
+		{"IN", dns.ClassINET},
+		{"in", dns.ClassINET},
+		{"CH", dns.ClassCHAOS},
+		{"HS", dns.ClassHESIOD},
+		{"ANY", dns.ClassANY},
+		{"CLASS3", 3},
+		{"CLASS65280", 65280},
+		{"CLASSX", 0},
+		{"NOPE", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.class, func(t *testing.T) {
+			if got := ClassToInt(tt.class); got != tt.want {
+				t.Errorf("ClassToInt(%q) = %d, want %d", tt.class, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEdnsOpt(t *testing.T) {
+	tests := []struct {
+		opt  string
+		code uint16
+		data string
+		err  bool
+	}{
+		{"100", 100, "", false},
+		{"65001:beef", 65001, "beef", false},
+		{"10:", 10, "", false},
+		{"65536", 0, "", true},
+		{"-1", 0, "", true},
+		{"nsid", 0, "", true},
+		{"100:xyz", 0, "", true},
+		{"100:abc", 0, "", true}, // Odd length
+	}
+	for _, tt := range tests {
+		t.Run(tt.opt, func(t *testing.T) {
+			o, err := ParseEdnsOpt(tt.opt)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if o.Code != tt.code || hex.EncodeToString(o.Data) != tt.data {
+				t.Errorf("ParseEdnsOpt(%q) = %d:%x, want %d:%s", tt.opt, o.Code, o.Data, tt.code, tt.data)
+			}
+		})
+	}
+}
+
+func TestNSID(t *testing.T) {
+	// msg with opts in the OPT record, nil for no OPT at all
+	msg := func(opts ...dns.EDNS0) *dns.Msg {
+		m := new(dns.Msg)
+		if opts != nil {
+			m.SetEdns0(1232, false)
+			m.IsEdns0().Option = opts
+		}
+		return m
+	}
+
+	tests := []struct {
+		name string
+		msg  *dns.Msg
+		want string
+	}{
+		{"no opt", msg(), ""},
+		{"no nsid", msg(&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0123456789abcdef"}), ""},
+		{"text", msg(&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte("s1.sto"))}), "s1.sto"},
+		{"binary", msg(&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: "00ff10"}), "00ff10"},
+		{"not hex", msg(&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: "zz"}), "zz"},
+		{"empty", msg(&dns.EDNS0_NSID{Code: dns.EDNS0NSID}), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NSID(tt.msg); got != tt.want {
+				t.Errorf("NSID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package dig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// String
+//
+// Format the result the way dig does.
+// The query is included if ShowQuery is set (like +qr).
+func (d DigOut) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "; <<>> zonetree dig <<>> @%s %s\n", d.QNSname, d.Qname)
+
+	if d.ShowQuery && d.Query != nil {
+		b.WriteString(";; Sending:\n")
+		b.WriteString(d.Query.String())
+		b.WriteString("\n")
+	}
+
+	if d.Error != "" {
+		fmt.Fprintf(&b, ";; communications error to %s: %s\n", d.Nameserver, d.Error)
+		return b.String()
+	}
+
+	b.WriteString(";; Got answer:\n")
+	b.WriteString(d.Response.String())
+	fmt.Fprintf(&b, "\n;; Query time: %d msec\n", d.RTT.Milliseconds())
+	fmt.Fprintf(&b, ";; SERVER: %s (%s)\n", d.Nameserver, strings.ToUpper(d.Transport))
+	fmt.Fprintf(&b, ";; MSG SIZE  rcvd: %d\n", d.MsgSize)
+
+	return b.String()
+}
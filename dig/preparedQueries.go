@@ -19,6 +19,9 @@ func NewQuery() Query {
 		ShowQuery:  false,
 		UDPsize:    1232,
 		Tsig:       "",
+		Timeout:    DefaultTimeout,
+		Retries:    0,
+		Backoff:    DefaultBackoff,
 	}
 }
 
@@ -39,6 +42,9 @@ var GetPatentData = Query{
 	ShowQuery:  false,
 	UDPsize:    1232,
 	Tsig:       "",
+	Timeout:    DefaultTimeout,
+	Retries:    0,
+	Backoff:    DefaultBackoff,
 }
 
 func SoaQuery() Query {
@@ -59,6 +65,9 @@ func SoaQuery() Query {
 		ShowQuery:  false,
 		UDPsize:    1232,
 		Tsig:       "",
+		Timeout:    DefaultTimeout,
+		Retries:    0,
+		Backoff:    DefaultBackoff,
 	}
 }
 
@@ -80,5 +89,8 @@ func ParentDelegQuery(parent, child string) Query {
 		ShowQuery:  false,
 		UDPsize:    1232,
 		Tsig:       "",
+		Timeout:    DefaultTimeout,
+		Retries:    0,
+		Backoff:    DefaultBackoff,
 	}
 }
@@ -2,6 +2,7 @@ package dig
 
 import (
 	"strings"
+	"time"
 	"zonetree/logger"
 
 	"github.com/miekg/dns"
@@ -22,6 +23,10 @@ type DigData struct {
 	Answer        []DigRR
 	Authoritative []DigRR
 	Additional    []DigRR
+	RTT           time.Duration // Zero if no response was received
+	MsgSize       int
+	Cookie        string // DNS Cookie option of the response, as hex
+	Attempts      int    // Queries sent, see DigOut
 }
 
 type DigRR struct {
@@ -45,11 +50,15 @@ func GetDelegation(q Query, log logger.Logger) (DigData, error) {
 
 	var data DigData
 
-	msg, err := Dig(q)
+	out, err := Exchange(q)
+	data.Attempts = out.Attempts
 	if err != nil {
 		log.Error("Nameserver reported error looking up domain", "domain", err.Error())
 		return data, err
 	}
+	msg := out.Response
+
+	data.RTT = out.RTT
 
 	data.Rcode = dns.RcodeToString[msg.MsgHdr.Rcode]
 	data.AA = msg.MsgHdr.Authoritative
@@ -58,6 +67,9 @@ func GetDelegation(q Query, log logger.Logger) (DigData, error) {
 	data.RD = msg.MsgHdr.RecursionDesired
 	data.RA = msg.MsgHdr.RecursionAvailable
 
+	data.MsgSize = out.MsgSize
+	data.Cookie = Cookie(msg)
+
 	if data.Rcode == "NOERROR" {
 		log.Debug("Got reply", "QNAME", q.Qname, "server", q.Nameserver)
 
@@ -117,30 +129,34 @@ func Path(dom string) []string {
 	return tree
 }
 
-func QndQuery(qname, resolver string, log logger.Logger) ([]string, error) {
+// QndQuery
+//
+// Quick and dirty lookup of A and AAAA for q.Qname at q.Nameserver.
+// Any other settings (timeouts, retries etc) are taken from q as is.
+// Returns the addresses and the number of queries actually sent,
+// retries and TCP fallbacks included.
+func QndQuery(q Query, log logger.Logger) ([]string, int, error) {
 
 	var iplist []string
 
-	q := NewQuery()
 	q.RD = true
-	q.Nameserver = resolver
-	q.Qname = qname
 
 	// Get IPv4 servers
 	q.Qtype = "A"
 
 	log.Debug("Sending query", "Query", q)
 
-	msg, err := Dig(q)
+	out, err := Exchange(q)
+	attempts := out.Attempts
 
 	if err != nil {
 		log.Error("Error doing QndQuery (A) ", "domain", err.Error())
 	}
 
-	rcode := dns.RcodeToString[msg.MsgHdr.Rcode]
+	rcode := dns.RcodeToString[out.Response.MsgHdr.Rcode]
 
 	if rcode == "NOERROR" {
-		for _, an := range msg.Answer {
+		for _, an := range out.Response.Answer {
 			iplist = append(iplist, dns.Field(an, 1))
 		}
 
@@ -148,20 +164,21 @@ func QndQuery(qname, resolver string, log logger.Logger) ([]string, error) {
 
 	// Get IPv6 servers
 	q.Qtype = "AAAA"
-	msg, err = Dig(q)
+	out, err = Exchange(q)
+	attempts += out.Attempts
 
 	if err != nil {
 		log.Error("Error doing QndQuery (AAAA)", "domain", err.Error())
 	}
 
-	rcode = dns.RcodeToString[msg.MsgHdr.Rcode]
+	rcode = dns.RcodeToString[out.Response.MsgHdr.Rcode]
 
 	if rcode == "NOERROR" {
-		for _, an := range msg.Answer {
+		for _, an := range out.Response.Answer {
 			iplist = append(iplist, dns.Field(an, 1))
 		}
 
 	}
 
-	return iplist, err
+	return iplist, attempts, err
 }
@@ -11,22 +11,33 @@ import (
 )
 
 type Query struct {
-	Nameserver string `json:"Nameserver"`
-	Transport  string `json:"Transport"`
-	Qname      string `json:"Qname"`
-	Qtype      string `json:"Qtype"`
-	Port       string `json:"Port"`
-	IpVersion  string `json:"IpVersion"`
-	AA         bool   `json:"AA"`
-	AD         bool   `json:"AD"`
-	CD         bool   `json:"CD"`
-	RD         bool   `json:"RD"`
-	DO         bool   `json:"DO"`
-	NoCrypto   bool   `json:"NoCrypto"`
-	Nsid       bool   `json:"Nsid"`
-	ShowQuery  bool   `json:"ShowQuery"`
-	UDPsize    uint16 `json:"UDPsize"`
-	Tsig       string `json:"Tsig"`
+	Nameserver   string        `json:"Nameserver"`
+	Transport    string        `json:"Transport"`
+	Qname        string        `json:"Qname"`
+	Qtype        string        `json:"Qtype"`
+	Qclass       string        `json:"Qclass"` // IN if empty
+	Port         string        `json:"Port"`
+	IpVersion    string        `json:"IpVersion"`
+	AA           bool          `json:"AA"`
+	AD           bool          `json:"AD"`
+	CD           bool          `json:"CD"`
+	RD           bool          `json:"RD"`
+	DO           bool          `json:"DO"`
+	NoCrypto     bool          `json:"NoCrypto"`
+	Nsid         bool          `json:"Nsid"`
+	ShowQuery    bool          `json:"ShowQuery"`
+	UDPsize      uint16        `json:"UDPsize"`
+	NoEdns       bool          `json:"NoEdns"`       // Send no OPT record at all
+	EdnsVersion  uint8         `json:"EdnsVersion"`  // Only 0 is defined
+	EdnsFlags    uint16        `json:"EdnsFlags"`    // Extra (Z) flags in the OPT record, besides DO
+	EdnsOpt      string        `json:"EdnsOpt"`      // Extra option, as code[:hex data], like dig +ednsopt
+	TCPFallback  bool          `json:"TCPFallback"`  // Retry truncated UDP responses over TCP, like dig
+	FixedUDPsize bool          `json:"FixedUDPsize"` // Advertise UDPsize as is, also with DO and NSID
+	Cookie       string        `json:"Cookie"`       // DNS Cookie option, as hex: client cookie, optionally followed by the server cookie
+	Tsig         string        `json:"Tsig"`
+	Timeout      time.Duration `json:"Timeout"` // per attempt dial/read/write timeout
+	Retries      int           `json:"Retries"` // extra attempts when no response is received
+	Backoff      time.Duration `json:"Backoff"` // wait before first retry, doubled for each retry
 }
 
 type DigOut struct {
@@ -39,6 +50,8 @@ type DigOut struct {
 	ShowQuery  bool          `json:"ShowQuery"`
 	MsgSize    int           `json:"Message Size"`
 	Transport  string        `json:"Transport"`
+	Attempts   int           `json:"Attempts"`        // Queries sent, including retries and TCP fallback
+	Error      string        `json:"Error,omitempty"` // Set if no response was received
 }
 
 // sanitize input data as precaution
@@ -63,8 +76,10 @@ func GetSystemResolver() string {
 func GetSystemResolver(ipver string) string {
 	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
 	if err != nil {
-		//fmt.Fprintln(os.Stderr, err)
-		os.Exit(2)
+		// No resolver to be found. The query will fail with an error
+		// instead of taking the whole process down.
+		fmt.Fprintln(os.Stderr, err)
+		return ""
 	}
 	// check for the first available server of right i version
 	var ns string
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"zonetree/cache"
+	"zonetree/logger"
+)
+
+// export
+//
+// Print zones from a saved cache file (see CacheFile in the server config)
+// as RFC 1035 master file text.
+func export(args []string) int {
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	file := fs.String("cache", "", "cache file to read, as CacheFile in the server config (required)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: zonetree export -cache file zone...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || *file == "" {
+		fs.Usage()
+		return 2
+	}
+
+	if _, err := os.Stat(*file); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read cache file: %v\n", err)
+		return 1
+	}
+
+	cfg := &cache.Config{
+		Log:   logger.DummyLogger{},
+		Zones: cache.NewZoneCache(),
+		Cache: cache.NewServerCache(),
+	}
+	if err := cfg.LoadFile(*file); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load cache file: %v\n", err)
+		return 1
+	}
+
+	status := 0
+	for _, name := range fs.Args() {
+		zone, ok := cfg.Zones.Get(cache.ToFQDN(name))
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Zone not in cache: %s\n", name)
+			status = 1
+			continue
+		}
+		fmt.Print(zone.ToZoneFile())
+	}
+
+	return status
+}
@@ -41,6 +41,8 @@ const NODEEND = `
 type Node struct {
 	Name     string `json:"Name"`
 	Parent   *Node  `json:"-"`
+	Alias    string `json:"Alias,omitempty"` // Set on alias nodes. Name of the tree the children belong to
+	Color    string `json:"Color,omitempty"` // Set by what-if simulations
 	Children []Node `json:"Children"`
 }
 
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"flag"
+	"os"
+
 	"zonetree/api"
 )
 
 func main() {
 
-	api.Run()
+	// zonetree export -cache file zone...
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(export(os.Args[2:]))
+	}
+
+	serverConf := flag.String("server", "server.yaml", "server config file (YAML)")
+	flag.Parse()
+
+	api.Run(*serverConf)
 
 }
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"cmp"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// All metrics are registered with the default Prometheus registry and
+// served by promhttp in the api package.
+var (
+	Queries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "zonetree",
+			Name:      "dns_queries_total",
+			Help:      "DNS queries sent, by response rcode and transport.",
+		},
+		[]string{"rcode", "transport"},
+	)
+
+	Timeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "zonetree",
+			Name:      "dns_query_timeouts_total",
+			Help:      "DNS queries that got no response, by transport.",
+		},
+		[]string{"transport"},
+	)
+
+	RTT = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "zonetree",
+			Name:      "dns_query_rtt_seconds",
+			Help:      "Round trip time of answered DNS queries.",
+			Buckets:   []float64{.002, .005, .01, .025, .05, .1, .25, .5, 1, 2},
+		},
+		[]string{"transport"},
+	)
+
+	ZoneBuilds = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "zonetree",
+			Name:      "zone_builds_total",
+			Help:      "Zones prepared by BuildZoneCache, by resulting zone status.",
+		},
+		[]string{"status"},
+	)
+
+	BuildDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "zonetree",
+			Name:      "build_duration_seconds",
+			Help:      "Wall clock time of a full BuildZoneCache run.",
+			Buckets:   prometheus.ExponentialBuckets(.05, 2, 10),
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(Queries, Timeouts, RTT, ZoneBuilds, BuildDuration)
+}
+
+// ObserveQuery
+//
+// Record the outcome of a single DNS query. Queries without a response
+// get rcode TIMEOUT if they timed out, ERROR for any other error.
+// Servers are not used as labels, there is no end to them.
+func ObserveQuery(transport, rcode string, rtt time.Duration, err error) {
+	var ne net.Error
+	switch {
+	case errors.As(err, &ne) && ne.Timeout():
+		Timeouts.WithLabelValues(transport).Inc()
+		rcode = "TIMEOUT"
+	case err != nil:
+		rcode = "ERROR"
+	default:
+		RTT.WithLabelValues(transport).Observe(rtt.Seconds())
+	}
+	Queries.WithLabelValues(rcode, transport).Inc()
+}
+
+// ObserveZone
+//
+// Record the resulting status of a prepared zone.
+func ObserveZone(status int32) {
+	ZoneBuilds.WithLabelValues(strconv.FormatInt(int64(status), 10)).Inc()
+}
+
+// CacheSize
+//
+// Register a gauge reporting the size of a cache, e.g. Zones.Count
+func CacheSize(name string, count func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace:   "zonetree",
+			Name:        "cache_entries",
+			Help:        "Number of entries in the cache.",
+			ConstLabels: prometheus.Labels{"cache": name},
+		},
+		func() float64 { return float64(count()) },
+	))
+}
+
+// ServerTimeout
+//
+// Timeouts of one address of a nameserver
+type ServerTimeout struct {
+	Server   string
+	IP       string
+	Timeouts int
+}
+
+// ServerTimeouts
+//
+// Register a gauge with the timeouts of the top servers returned by
+// list, e.g. the SRTT data of the Server cache. Only the worst top
+// servers are exported, so the number of series stays bounded no
+// matter how many servers are known.
+func ServerTimeouts(top int, list func() []ServerTimeout) {
+	prometheus.MustRegister(&timeoutCollector{
+		desc: newTimeoutDesc(),
+		top:  top,
+		list: list,
+	})
+}
+
+func newTimeoutDesc() *prometheus.Desc {
+	return prometheus.NewDesc("zonetree_server_timeouts",
+		"Timeouts of the nameserver addresses with the most timeouts.",
+		[]string{"server", "ip"}, nil)
+}
+
+type timeoutCollector struct {
+	desc *prometheus.Desc
+	top  int
+	list func() []ServerTimeout
+}
+
+func (tc *timeoutCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tc.desc
+}
+
+func (tc *timeoutCollector) Collect(ch chan<- prometheus.Metric) {
+	list := slices.DeleteFunc(tc.list(), func(st ServerTimeout) bool { return st.Timeouts == 0 })
+	slices.SortFunc(list, func(a, b ServerTimeout) int {
+		return cmp.Or(cmp.Compare(b.Timeouts, a.Timeouts), cmp.Compare(a.Server, b.Server), cmp.Compare(a.IP, b.IP))
+	})
+	for _, st := range list[:min(tc.top, len(list))] {
+		ch <- prometheus.MustNewConstMetric(tc.desc, prometheus.GaugeValue, float64(st.Timeouts), st.Server, st.IP)
+	}
+}
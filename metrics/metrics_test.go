@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestServerTimeouts(t *testing.T) {
+	tc := &timeoutCollector{desc: newTimeoutDesc(), top: 2, list: func() []ServerTimeout {
+		return []ServerTimeout{
+			{"ns1.example.", "192.0.2.1", 1},
+			{"ns2.example.", "192.0.2.2", 5},
+			{"ns3.example.", "192.0.2.3", 0},
+			{"ns3.example.", "2001:db8::3", 3},
+		}
+	}}
+
+	want := `# HELP zonetree_server_timeouts Timeouts of the nameserver addresses with the most timeouts.
+# TYPE zonetree_server_timeouts gauge
+zonetree_server_timeouts{ip="192.0.2.2",server="ns2.example."} 5
+zonetree_server_timeouts{ip="2001:db8::3",server="ns3.example."} 3
+`
+	if err := testutil.CollectAndCompare(tc, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}